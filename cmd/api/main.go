@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/LucasLCabral/go-bid/internal/api"
@@ -48,6 +49,31 @@ func main() {
 	s.Cookie.HttpOnly = true
 	s.Cookie.SameSite = http.SameSiteLaxMode
 
+	// a single instance can keep its events in memory; every instance of a
+	// cluster has to share them through Postgres
+	var bus services.EventBus
+	if os.Getenv("GOBID_EVENT_BUS") == "memory" {
+		bus = services.NewMemoryEventBus()
+	} else {
+		pgBus := services.NewPostgresEventBus(pool)
+		go pgBus.Run(ctx)
+		bus = pgBus
+	}
+
+	maxConnections := services.DefaultMaxConnectionsPerUser
+	if raw := os.Getenv("GOBID_MAX_CONNECTIONS_PER_USER"); raw != "" {
+		if maxConnections, err = strconv.Atoi(raw); err != nil {
+			panic(err)
+		}
+	}
+
+	maxSpectators := services.DefaultMaxSpectators
+	if raw := os.Getenv("GOBID_MAX_SPECTATORS"); raw != "" {
+		if maxSpectators, err = strconv.Atoi(raw); err != nil {
+			panic(err)
+		}
+	}
+
 	api := api.API{
 		Router:          chi.NewMux(),
 		UserService:     services.NewUserService(pool),
@@ -60,12 +86,20 @@ func main() {
 			},
 		},
 		AuctionLobby: &services.AuctionLobby{
-			Rooms: make(map[uuid.UUID]*services.AuctionRoom),
+			Rooms:                 make(map[uuid.UUID]*services.AuctionRoom),
+			MaxConnectionsPerUser: maxConnections,
+			MaxSpectators:         maxSpectators,
 		},
-		
+		EventBus: bus,
 	}
 	api.BindRoutes()
 
+	go api.WatchLobby(ctx)
+
+	if err := api.RestoreAuctionRooms(ctx); err != nil {
+		panic(err)
+	}
+
 	fmt.Println("Starting server on :3080")
 	if err := http.ListenAndServe(":3080", api.Router); err != nil {
 		panic(err)
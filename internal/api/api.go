@@ -16,4 +16,5 @@ type API struct {
 	WSUpgrader      *websocket.Upgrader
 	AuctionLobby    *services.AuctionLobby
 	BidsService     *services.BidsService
+	EventBus        services.EventBus
 }
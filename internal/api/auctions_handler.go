@@ -1,16 +1,39 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/LucasLCabral/go-bid/internal/jsonutils"
 	"github.com/LucasLCabral/go-bid/internal/services"
+	"github.com/LucasLCabral/go-bid/internal/store/pgstore"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
 func (a *API) HandleSubscribeUserToAuction(w http.ResponseWriter, r *http.Request) {
+	userId, ok := a.Sessions.Get(r.Context(), "AuthenticatedUserId").(uuid.UUID)
+	if !ok {
+		jsonutils.EncodeJson(w, r, http.StatusUnauthorized, map[string]any{
+			"error": "unexpected error",
+		})
+		return
+	}
+	a.subscribeToAuction(w, r, &userId)
+}
+
+// HandleWatchAuction lets visitors without a session follow an auction as
+// spectators, who cannot bid.
+func (a *API) HandleWatchAuction(w http.ResponseWriter, r *http.Request) {
+	a.subscribeToAuction(w, r, nil)
+}
+
+// subscribeToAuction connects a websocket to the room of the product of r,
+// for userID or, when it is nil, for a spectator.
+func (a *API) subscribeToAuction(w http.ResponseWriter, r *http.Request, userID *uuid.UUID) {
 	rawProductID := chi.URLParam(r, "product_id")
 	productID, err := uuid.Parse(rawProductID)
 	if err != nil {
@@ -32,15 +55,26 @@ func (a *API) HandleSubscribeUserToAuction(w http.ResponseWriter, r *http.Reques
 		})
 		return
 	}
-	userId, ok := a.Sessions.Get(r.Context(), "AuthenticatedUserId").(uuid.UUID)
-	if !ok {
-		jsonutils.EncodeJson(w, r, http.StatusUnauthorized, map[string]any{
-			"error": "unexpected error",
+	policy, lastSeq, lastEpoch, err := clientOptions(r)
+	if err != nil {
+		jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error": err.Error(),
 		})
 		return
 	}
+	version, subprotocol, err := services.NegotiateProtocol(r)
+	if err != nil {
+		jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	var header http.Header
+	if subprotocol != "" {
+		header = http.Header{"Sec-Websocket-Protocol": {subprotocol}}
+	}
 
-	conn, err := a.WSUpgrader.Upgrade(w, r, nil)
+	conn, err := a.WSUpgrader.Upgrade(w, r, header)
 	if err != nil {
 		jsonutils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
 			"error": "failed to upgrade to websocket: " + err.Error(),
@@ -59,9 +93,195 @@ func (a *API) HandleSubscribeUserToAuction(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	client := services.NewClient(room, conn, userId)
+	var client *services.Client
+	if userID != nil {
+		client = services.NewClient(room, conn, *userID, policy, lastSeq)
+	} else {
+		client = services.NewSpectator(room, conn, policy, lastSeq)
+	}
+	client.Version = version
+	client.LastEpoch = lastEpoch
 
-	room.Register <- client
+	if !room.Join(client) {
+		conn.WriteJSON(map[string]any{
+			"error": "auction has ended",
+		})
+		conn.Close()
+		return
+	}
 	go client.ReadEventLoop()
 	go client.WriteEventLoop()
 }
+
+// HandleStreamAuctionEvents follows an auction through server-sent events,
+// for watchers that cannot hold a websocket. Its clients share the room, and
+// its connection caps, with the websocket clients; visitors without a
+// session follow it as spectators.
+func (a *API) HandleStreamAuctionEvents(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "product_id"))
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error": "invalid product id",
+		})
+		return
+	}
+	policy, lastSeq, lastEpoch, err := clientOptions(r)
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	version, _, err := services.NegotiateProtocol(r)
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	a.AuctionLobby.Lock()
+	room, ok := a.AuctionLobby.Rooms[productID]
+	a.AuctionLobby.Unlock()
+	if !ok {
+		// a status other than 200 stops browsers from reconnecting
+		_ = jsonutils.EncodeJson(w, r, http.StatusGone, map[string]any{
+			"error": "auction has ended",
+		})
+		return
+	}
+
+	var client *services.Client
+	if userID, ok := a.Sessions.Get(r.Context(), "AuthenticatedUserId").(uuid.UUID); ok {
+		client = services.NewClient(room, nil, userID, policy, lastSeq)
+	} else {
+		client = services.NewSpectator(room, nil, policy, lastSeq)
+	}
+	client.Version = version
+	client.LastEpoch = lastEpoch
+	if !room.Join(client) {
+		_ = jsonutils.EncodeJson(w, r, http.StatusGone, map[string]any{
+			"error": "auction has ended",
+		})
+		return
+	}
+	if err := client.StreamEvents(r.Context(), w); err != nil {
+		slog.Info("Event stream closed", "Client", client, "Error", err)
+	}
+}
+
+// clientOptions reads how a client subscribing to a room wants to be
+// treated. Clients resume from the last_seq and epoch query parameters, and
+// event streams from their Last-Event-ID header.
+func clientOptions(r *http.Request) (services.SlowClientPolicy, uint64, string, error) {
+	policy, err := services.ParseSlowClientPolicy(r.URL.Query().Get("slow_policy"))
+	if err != nil {
+		return 0, 0, "", err
+	}
+	var lastSeq uint64
+	lastEpoch := r.URL.Query().Get("epoch")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		if lastEpoch, lastSeq, err = services.ParseEventID(id); err != nil {
+			return 0, 0, "", errors.New("invalid last event id")
+		}
+	} else if raw := r.URL.Query().Get("last_seq"); raw != "" {
+		if lastSeq, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			return 0, 0, "", errors.New("invalid last seen sequence")
+		}
+	}
+	return policy, lastSeq, lastEpoch, nil
+}
+
+// startAuctionRoom opens the room of product, unless it is already open.
+func (a *API) startAuctionRoom(product pgstore.Product) {
+	a.AuctionLobby.Lock()
+	defer a.AuctionLobby.Unlock()
+	if _, ok := a.AuctionLobby.Rooms[product.ID]; ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	auctionRoom := services.NewAuctionRoom(ctx, product, *a.BidsService, a.EventBus)
+	auctionRoom.MaxConnectionsPerUser = a.AuctionLobby.MaxConnectionsPerUser
+	auctionRoom.MaxSpectators = a.AuctionLobby.MaxSpectators
+	a.AuctionLobby.Rooms[product.ID] = auctionRoom
+
+	go func() {
+		defer cancel()
+		auctionRoom.Run()
+
+		a.AuctionLobby.Lock()
+		if a.AuctionLobby.Rooms[product.ID] == auctionRoom {
+			delete(a.AuctionLobby.Rooms, product.ID)
+		}
+		a.AuctionLobby.Unlock()
+	}()
+}
+
+// finishAuctionRoom stops the rooms of an auction that was closed through the
+// REST API, sending message to their clients. Each room removes itself from
+// its lobby once it stops.
+func (a *API) finishAuctionRoom(ctx context.Context, productID uuid.UUID, message services.Message) {
+	a.publishRoomEvent(ctx, productID, services.RoomEvent{Message: message, Close: true})
+}
+
+// publishRoomEvent hands event to the rooms of productID on every instance.
+func (a *API) publishRoomEvent(ctx context.Context, productID uuid.UUID, event services.RoomEvent) {
+	if err := a.EventBus.Publish(ctx, productID, event); err != nil {
+		slog.Error("failed to publish room event", "ProductId", productID, "Error", err)
+	}
+}
+
+// WatchLobby opens the room of every auction announced on the event bus, such
+// as the auctions created by other instances, until ctx is done.
+func (a *API) WatchLobby(ctx context.Context) {
+	events, unsubscribe := a.EventBus.Subscribe(services.LobbyID)
+	defer unsubscribe()
+	for {
+		select {
+		case event := <-events:
+			if event.Message.Kind == services.AuctionCreated {
+				a.openAuctionRoom(ctx, event.AuctionID)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// openAuctionRoom starts the room of an auction announced on the lobby.
+func (a *API) openAuctionRoom(ctx context.Context, productID uuid.UUID) {
+	a.AuctionLobby.Lock()
+	_, ok := a.AuctionLobby.Rooms[productID]
+	a.AuctionLobby.Unlock()
+	if ok {
+		return
+	}
+
+	product, err := a.ProductsService.GetProductByID(ctx, productID)
+	if err != nil {
+		slog.Error("failed to open auction room", "ProductId", productID, "Error", err)
+		return
+	}
+	a.startAuctionRoom(product)
+}
+
+// RestoreAuctionRooms starts a room for every auction that was still running
+// when the server went down, so bidders can keep subscribing after a restart.
+// Auctions that ended in the meantime get a room too, which settles them
+// right away.
+func (a *API) RestoreAuctionRooms(ctx context.Context) error {
+	products, err := a.ProductsService.ListActiveAuctions(ctx)
+	if err != nil {
+		return err
+	}
+	overdue, err := a.ProductsService.ListOverdueAuctions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, product := range append(overdue, products...) {
+		a.startAuctionRoom(product)
+	}
+	slog.Info("Auction rooms restored", "Count", len(products), "Overdue", len(overdue))
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/LucasLCabral/go-bid/internal/jsonutils"
+	"github.com/google/uuid"
 	"github.com/gorilla/csrf"
 )
 
@@ -26,3 +27,24 @@ func (a *API) AuthMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// AdminMiddleware only lets admins through. It must run after AuthMiddleware.
+func (a *API) AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := a.Sessions.Get(r.Context(), "AuthenticatedUserId").(uuid.UUID)
+		isAdmin, err := a.UserService.IsAdmin(r.Context(), userID)
+		if err != nil {
+			jsonutils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
+				"error": "internal server error",
+			})
+			return
+		}
+		if !isAdmin {
+			jsonutils.EncodeJson(w, r, http.StatusForbidden, map[string]any{
+				"error": "must be an admin",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
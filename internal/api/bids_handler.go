@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/LucasLCabral/go-bid/internal/jsonutils"
+	"github.com/LucasLCabral/go-bid/internal/services"
+	"github.com/LucasLCabral/go-bid/internal/usecase/bid"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (a *API) HandleRetractBid(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "product_id"))
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error": "invalid product id",
+		})
+		return
+	}
+	bidID, err := uuid.Parse(chi.URLParam(r, "bid_id"))
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error": "invalid bid id",
+		})
+		return
+	}
+	data, problems, err := jsonutils.DecodeValidJson[bid.RetractBidReq](r)
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, problems)
+		return
+	}
+	userID, ok := a.Sessions.Get(r.Context(), "AuthenticatedUserId").(uuid.UUID)
+	if !ok {
+		_ = jsonutils.EncodeJson(w, r, http.StatusUnauthorized, map[string]any{
+			"error": "must be logged in",
+		})
+		return
+	}
+
+	retracted, err := a.BidsService.RetractBid(r.Context(), productID, bidID, userID, data.Reason)
+	if err != nil {
+		encodeRetractBidError(w, r, err)
+		return
+	}
+	a.notifyBidRetracted(r.Context(), retracted, data.Reason)
+
+	_ = jsonutils.EncodeJson(w, r, http.StatusOK, map[string]any{
+		"message": "bid retracted successfully",
+		"bid_id":  bidID,
+	})
+}
+
+func (a *API) HandleVoidBid(w http.ResponseWriter, r *http.Request) {
+	bidID, err := uuid.Parse(chi.URLParam(r, "bid_id"))
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error": "invalid bid id",
+		})
+		return
+	}
+	data, problems, err := jsonutils.DecodeValidJson[bid.RetractBidReq](r)
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, problems)
+		return
+	}
+	userID, ok := a.Sessions.Get(r.Context(), "AuthenticatedUserId").(uuid.UUID)
+	if !ok {
+		_ = jsonutils.EncodeJson(w, r, http.StatusUnauthorized, map[string]any{
+			"error": "must be logged in",
+		})
+		return
+	}
+
+	retracted, err := a.BidsService.VoidBid(r.Context(), bidID, userID, data.Reason)
+	if err != nil {
+		encodeRetractBidError(w, r, err)
+		return
+	}
+	a.notifyBidRetracted(r.Context(), retracted, data.Reason)
+
+	_ = jsonutils.EncodeJson(w, r, http.StatusOK, map[string]any{
+		"message": "bid voided successfully",
+		"bid_id":  bidID,
+	})
+}
+
+// notifyBidRetracted tells the clients of the auction which bid leads it after
+// a retraction. Rooms of sealed-bid auctions are left alone.
+func (a *API) notifyBidRetracted(ctx context.Context, retracted services.RetractedBid, reason string) {
+	if retracted.Sealed {
+		return
+	}
+
+	productID := retracted.Bid.ProductID
+	a.publishRoomEvent(ctx, productID, services.RoomEvent{Message: services.BidRetractedMessage(retracted, reason)})
+	if retracted.HasReserve {
+		a.publishRoomEvent(ctx, productID, services.RoomEvent{Message: services.ReserveStatusMessage(retracted.ReserveMet)})
+	}
+}
+
+func encodeRetractBidError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrBidNotFound):
+		_ = jsonutils.EncodeJson(w, r, http.StatusNotFound, map[string]any{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrNotBidder):
+		_ = jsonutils.EncodeJson(w, r, http.StatusForbidden, map[string]any{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrAuctionEnded), errors.Is(err, services.ErrRetractionTooLate):
+		_ = jsonutils.EncodeJson(w, r, http.StatusConflict, map[string]any{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrRetractionLimit):
+		_ = jsonutils.EncodeJson(w, r, http.StatusTooManyRequests, map[string]any{
+			"error": err.Error(),
+		})
+	default:
+		_ = jsonutils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
+			"error": "internal server error",
+		})
+	}
+}
@@ -1,12 +1,14 @@
 package api
 
 import (
-	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/LucasLCabral/go-bid/internal/jsonutils"
 	"github.com/LucasLCabral/go-bid/internal/services"
 	"github.com/LucasLCabral/go-bid/internal/usecase/product"
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
@@ -23,31 +25,163 @@ func (a *API) HandleCreateProduct(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	productId, err := a.ProductsService.CreateProduct(
-		r.Context(),
-		userID,
-		data.ProductName,
-		data.Description,
-		data.BasePrice,
-		data.AuctionEnd,
-	)
+	created, err := a.ProductsService.CreateProduct(r.Context(), userID, data)
 	if err != nil {
 		_ = jsonutils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
 			"error": "internal server error",
 		})
 		return
 	}
-	ctx, _ := context.WithDeadline(context.Background(), data.AuctionEnd)
-	auctionRoom := services.NewAuctionRoom(ctx, productId, *a.BidsService)
+	a.startAuctionRoom(created)
+	a.publishRoomEvent(r.Context(), services.LobbyID, services.RoomEvent{
+		AuctionID: created.ID,
+		Message:   services.Message{Kind: services.AuctionCreated},
+	})
 
-	go auctionRoom.Run()
+	message := "Auction has started with success"
+	if created.AuctionStart.After(time.Now()) {
+		message = "Auction has been scheduled with success"
+	}
+	jsonutils.EncodeJson(w, r, http.StatusCreated, map[string]any{
+		"message":       message,
+		"product_id":    created.ID,
+		"auction_start": created.AuctionStart,
+	})
+}
 
-	a.AuctionLobby.Lock()
-	a.AuctionLobby.Rooms[productId] = auctionRoom
-	a.AuctionLobby.Unlock()
+func (a *API) HandleBuyNow(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "product_id"))
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error": "invalid product id",
+		})
+		return
+	}
+	userID, ok := a.Sessions.Get(r.Context(), "AuthenticatedUserId").(uuid.UUID)
+	if !ok {
+		_ = jsonutils.EncodeJson(w, r, http.StatusUnauthorized, map[string]any{
+			"error": "must be logged in",
+		})
+		return
+	}
 
-	jsonutils.EncodeJson(w, r, http.StatusCreated, map[string]any{
-		"message": "Auction has started with success",
-		"product_id": productId,
+	result, err := a.BidsService.BuyNow(r.Context(), productID, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			_ = jsonutils.EncodeJson(w, r, http.StatusNotFound, map[string]any{
+				"error": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, services.ErrBuyNowUnavailable) {
+			_ = jsonutils.EncodeJson(w, r, http.StatusConflict, map[string]any{
+				"error": err.Error(),
+			})
+			return
+		}
+		_ = jsonutils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	a.finishAuctionRoom(r.Context(), productID, services.AuctionEndedMessage(result))
+
+	_ = jsonutils.EncodeJson(w, r, http.StatusOK, map[string]any{
+		"message":    "product bought successfully",
+		"product_id": productID,
+		"price":      result.FinalPrice,
+		"currency":   result.Currency,
 	})
 }
+
+func (a *API) HandleCancelAuction(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "product_id"))
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error": "invalid product id",
+		})
+		return
+	}
+	data, problems, err := jsonutils.DecodeValidJson[product.CloseAuctionReq](r)
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, problems)
+		return
+	}
+	userID, ok := a.Sessions.Get(r.Context(), "AuthenticatedUserId").(uuid.UUID)
+	if !ok {
+		_ = jsonutils.EncodeJson(w, r, http.StatusUnauthorized, map[string]any{
+			"error": "must be logged in",
+		})
+		return
+	}
+
+	if err := a.BidsService.CancelAuction(r.Context(), productID, userID, data.Reason); err != nil {
+		encodeCloseAuctionError(w, r, err)
+		return
+	}
+	a.finishAuctionRoom(r.Context(), productID, services.AuctionCancelledMessage(data.Reason))
+
+	_ = jsonutils.EncodeJson(w, r, http.StatusOK, map[string]any{
+		"message":    "auction cancelled successfully",
+		"product_id": productID,
+	})
+}
+
+func (a *API) HandleEndAuctionEarly(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "product_id"))
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error": "invalid product id",
+		})
+		return
+	}
+	data, problems, err := jsonutils.DecodeValidJson[product.CloseAuctionReq](r)
+	if err != nil {
+		_ = jsonutils.EncodeJson(w, r, http.StatusBadRequest, problems)
+		return
+	}
+	userID, ok := a.Sessions.Get(r.Context(), "AuthenticatedUserId").(uuid.UUID)
+	if !ok {
+		_ = jsonutils.EncodeJson(w, r, http.StatusUnauthorized, map[string]any{
+			"error": "must be logged in",
+		})
+		return
+	}
+
+	result, err := a.BidsService.EndAuctionEarly(r.Context(), productID, userID, data.Reason)
+	if err != nil {
+		encodeCloseAuctionError(w, r, err)
+		return
+	}
+	a.finishAuctionRoom(r.Context(), productID, services.AuctionEndedMessage(result))
+
+	_ = jsonutils.EncodeJson(w, r, http.StatusOK, map[string]any{
+		"message":    "auction ended successfully",
+		"product_id": productID,
+		"winner_id":  result.WinnerID,
+		"price":      result.FinalPrice,
+		"currency":   result.Currency,
+	})
+}
+
+func encodeCloseAuctionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound):
+		_ = jsonutils.EncodeJson(w, r, http.StatusNotFound, map[string]any{
+			"error": "product not found",
+		})
+	case errors.Is(err, services.ErrNotSeller):
+		_ = jsonutils.EncodeJson(w, r, http.StatusForbidden, map[string]any{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrAuctionEnded), errors.Is(err, services.ErrNoBids):
+		_ = jsonutils.EncodeJson(w, r, http.StatusConflict, map[string]any{
+			"error": err.Error(),
+		})
+	default:
+		_ = jsonutils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
+			"error": "internal server error",
+		})
+	}
+}
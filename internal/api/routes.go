@@ -1,6 +1,8 @@
 package api
 
 import (
+	"expvar"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
@@ -27,13 +29,26 @@ func (a *API) BindRoutes() {
 			})
 
 			r.Route("/products", func(r chi.Router) {
+				r.Get("/ws/watch/{product_id}", a.HandleWatchAuction)
+				r.Get("/{product_id}/events", a.HandleStreamAuctionEvents)
+
 				r.Group(func(r chi.Router) {
 					r.Use(a.AuthMiddleware)
 					r.Post("/", a.HandleCreateProduct)
+					r.Post("/{product_id}/buy-now", a.HandleBuyNow)
+					r.Post("/{product_id}/cancel", a.HandleCancelAuction)
+					r.Post("/{product_id}/end", a.HandleEndAuctionEarly)
+					r.Delete("/{product_id}/bids/{bid_id}", a.HandleRetractBid)
 
 					r.Get("/ws/subscribe/{product_id}", a.HandleSubscribeUserToAuction)
 				})
 			})
+
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(a.AuthMiddleware, a.AdminMiddleware)
+				r.Post("/bids/{bid_id}/void", a.HandleVoidBid)
+				r.Handle("/debug/vars", expvar.Handler())
+			})
 		})
 	})
 }
@@ -0,0 +1,56 @@
+package money
+
+import "testing"
+
+func TestCurrencyMinorUnit(t *testing.T) {
+	tests := []struct {
+		currency Currency
+		want     Amount
+	}{
+		{currency: "USD", want: Cent},
+		{currency: "JPY", want: Unit},
+		{currency: "BHD", want: 10},
+		{currency: "CLF", want: 1},
+	}
+	for _, tt := range tests {
+		if got := tt.currency.MinorUnit(); got != tt.want {
+			t.Errorf("%s.MinorUnit() = %d, want %d", tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestCurrencyRoundUp(t *testing.T) {
+	tests := []struct {
+		currency Currency
+		amount   Amount
+		want     Amount
+	}{
+		{currency: "JPY", amount: 2*Unit + 50*Cent, want: 3 * Unit},
+		{currency: "JPY", amount: 3 * Unit, want: 3 * Unit},
+		{currency: "USD", amount: Unit + 1, want: Unit + Cent},
+		{currency: "USD", amount: 25 * Cent, want: 25 * Cent},
+	}
+	for _, tt := range tests {
+		if got := tt.currency.RoundUp(tt.amount); got != tt.want {
+			t.Errorf("%s.RoundUp(%s) = %s, want %s", tt.currency, tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestCurrencyAllows(t *testing.T) {
+	if Currency("JPY").Allows(Unit + 50*Cent) {
+		t.Error("JPY allows fractions of a yen")
+	}
+	if !Currency("USD").Allows(Unit + 50*Cent) {
+		t.Error("USD does not allow cents")
+	}
+}
+
+func TestCurrencyFormat(t *testing.T) {
+	if got := Currency("USD").Format(Unit + 50*Cent); got != "1.50 USD" {
+		t.Errorf("Format = %q", got)
+	}
+	if got := Currency("JPY").Format(100 * Unit); got != "100 JPY" {
+		t.Errorf("Format = %q", got)
+	}
+}
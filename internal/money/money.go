@@ -0,0 +1,146 @@
+// Package money represents amounts of money exactly, as fixed-point decimals,
+// so prices are never compared or added as binary floats.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is an exact amount of money, counted in ten-thousandths of a unit.
+// It is stored as NUMERIC(19, 4) and sent over JSON as a decimal string.
+type Amount int64
+
+const (
+	// Scale is the number of decimal places an Amount can hold.
+	Scale = 4
+
+	Cent Amount = 100
+	Unit Amount = 10_000
+	Max  Amount = math.MaxInt64
+)
+
+var (
+	ErrInvalidAmount = errors.New("invalid amount")
+	ErrTooPrecise    = errors.New("amount has too many decimal places")
+)
+
+// Parse reads a decimal amount such as "12", "12.5" or "-0.05". Amounts with
+// more than Scale significant decimal places are rejected with
+// ErrTooPrecise.
+func Parse(s string) (Amount, error) {
+	units, fraction, _ := strings.Cut(s, ".")
+	negative := strings.HasPrefix(units, "-")
+	units = strings.TrimPrefix(units, "-")
+	fraction = strings.TrimRight(fraction, "0")
+	if units == "" || !isDigits(units) || !isDigits(fraction) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(fraction) > Scale {
+		return 0, fmt.Errorf("%w: %q", ErrTooPrecise, s)
+	}
+
+	part, _ := strconv.ParseInt(fraction+strings.Repeat("0", Scale-len(fraction)), 10, 64)
+	whole, err := strconv.ParseInt(units, 10, 64)
+	if err != nil || Amount(whole) > (Max-Amount(part))/Unit {
+		return 0, fmt.Errorf("%w: %q is too large", ErrInvalidAmount, s)
+	}
+	amount := Amount(whole)*Unit + Amount(part)
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimals returns how many decimal places a needs to be written exactly.
+func (a Amount) Decimals() int {
+	decimals := Scale
+	for fraction := a % Unit; decimals > 0 && fraction%10 == 0; fraction /= 10 {
+		decimals--
+	}
+	return decimals
+}
+
+// Format writes a with the given number of decimal places, or with as many
+// as it needs to stay exact when that is more.
+func (a Amount) Format(decimals int) string {
+	decimals = max(min(decimals, Scale), a.Decimals())
+
+	sign, abs := "", uint64(a)
+	if a < 0 {
+		sign, abs = "-", uint64(-a)
+	}
+	units := strconv.FormatUint(abs/uint64(Unit), 10)
+	if decimals == 0 {
+		return sign + units
+	}
+	fraction := fmt.Sprintf("%0*d", Scale, abs%uint64(Unit))
+	return sign + units + "." + fraction[:decimals]
+}
+
+// String writes a with as few decimal places as it needs.
+func (a Amount) String() string {
+	return a.Format(0)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(a.String())), nil
+}
+
+// UnmarshalJSON accepts amounts both as JSON strings and as JSON numbers. The
+// number is read from its text, never through a float.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	amount, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns.
+func (a *Amount) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		amount, err := Parse(src)
+		if err != nil {
+			return err
+		}
+		*a = amount
+		return nil
+	case []byte:
+		return a.Scan(string(src))
+	case int64:
+		*a = Amount(src) * Unit
+		return nil
+	case nil:
+		return fmt.Errorf("%w: cannot scan NULL", ErrInvalidAmount)
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidAmount, src)
+	}
+}
+
+// Value implements driver.Valuer for NUMERIC columns.
+func (a Amount) Value() (driver.Value, error) {
+	return a.Format(Scale), nil
+}
@@ -0,0 +1,77 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		err  error
+	}{
+		{in: "12", want: 12 * Unit},
+		{in: "12.5", want: 12*Unit + 50*Cent},
+		{in: "-0.05", want: -5 * Cent},
+		{in: "0.0001", want: 1},
+		{in: "1.50000", want: Unit + 50*Cent},
+		{in: "", err: ErrInvalidAmount},
+		{in: "abc", err: ErrInvalidAmount},
+		{in: "1e3", err: ErrInvalidAmount},
+		{in: "1.2.3", err: ErrInvalidAmount},
+		{in: ".5", err: ErrInvalidAmount},
+		{in: "1.23456", err: ErrTooPrecise},
+		{in: "922337203685478", err: ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Parse(%q) error = %v, want %v", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount   Amount
+		decimals int
+		want     string
+	}{
+		{amount: 12*Unit + 50*Cent, decimals: 2, want: "12.50"},
+		{amount: 12*Unit + 50*Cent, decimals: 0, want: "12.5"},
+		{amount: 3 * Unit, decimals: 0, want: "3"},
+		{amount: 3 * Unit, decimals: 9, want: "3.0000"},
+		{amount: -5 * Cent, decimals: 2, want: "-0.05"},
+		{amount: 1, decimals: 2, want: "0.0001"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.Format(tt.decimals); got != tt.want {
+			t.Errorf("Amount(%d).Format(%d) = %q, want %q", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestFormatParseRoundTrip(t *testing.T) {
+	for _, amount := range []Amount{0, 1, Cent, Unit, -Unit - 1, 123456789} {
+		got, err := Parse(amount.String())
+		if err != nil || got != amount {
+			t.Errorf("Parse(%q) = %d, %v, want %d", amount.String(), got, err, amount)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	for _, data := range []string{`"12.5"`, `12.5`} {
+		var amount Amount
+		if err := amount.UnmarshalJSON([]byte(data)); err != nil || amount != 12*Unit+50*Cent {
+			t.Errorf("UnmarshalJSON(%s) = %d, %v", data, amount, err)
+		}
+	}
+}
@@ -5,130 +5,957 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"sync"
 	"time"
 
+	"github.com/LucasLCabral/go-bid/internal/money"
+	"github.com/LucasLCabral/go-bid/internal/store/pgstore"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 type MessageKind int
 
+// The values of MessageKind are part of protocol v1, so they are pinned:
+// new kinds take new values, and existing ones never change.
 const (
 	// requests
-	PlaceBid MessageKind = iota
+	PlaceBid MessageKind = 0
 
 	// success
-	SuccessfullyPlacedBid
+	SuccessfullyPlacedBid MessageKind = 1
 
 	// errors
-	FailedToPlaceBid
-	InvalidJson
+	FailedToPlaceBid MessageKind = 2
+	InvalidJson      MessageKind = 3
 
 	// info
-	NewBidPlaced
-	AuctionEnded
+	NewBidPlaced     MessageKind = 4
+	AuctionEnded     MessageKind = 5
+	AuctionExtended  MessageKind = 6
+	ReserveNotMet    MessageKind = 7
+	ReserveMet       MessageKind = 8
+	BuyNow           MessageKind = 9
+	FailedToBuyNow   MessageKind = 10
+	AcceptPrice      MessageKind = 11
+	PriceUpdated     MessageKind = 12
+	AuctionStarted   MessageKind = 13
+	AuctionCancelled MessageKind = 14
+	BidRetracted     MessageKind = 15
+
+	// lobby
+	AuctionCreated MessageKind = 16
+
+	// info
+	AuctionSnapshot MessageKind = 17
+	AuctionTick     MessageKind = 18
+
+	// time sync: clients send TimeSync and get TimeSyncReply back
+	TimeSync      MessageKind = 19
+	TimeSyncReply MessageKind = 20
 )
 
 type Message struct {
-	UserId    uuid.UUID   `json:"user_id,omitempty"`
-	Message   string      `json:"message,omitempty"`
-	Kind      MessageKind `json:"kind"`
-	BidAmount float64     `json:"bid_amount,omitempty"`
+	// Seq numbers the messages of a room in the order it delivered them, so
+	// reconnecting clients can ask for the ones they missed. Every room
+	// numbers its messages on its own, so Seq only means something together
+	// with the Epoch of the room.
+	Seq   uint64 `json:"seq,omitempty"`
+	Epoch string `json:"epoch,omitempty"`
+
+	// RequestID is chosen by the client on a request and echoed on the
+	// replies to it.
+	RequestID string `json:"request_id,omitempty"`
+
+	UserId     uuid.UUID    `json:"user_id,omitempty"`
+	Message    string       `json:"message,omitempty"`
+	Kind       MessageKind  `json:"kind"`
+	BidAmount  money.Amount `json:"bid_amount,omitempty"`
+	AuctionEnd *time.Time   `json:"auction_end,omitempty"`
+
+	// Currency is the currency of every amount in the message. Bids sent
+	// without one are taken to be in the currency of the product.
+	Currency money.Currency `json:"currency,omitempty"`
+
+	// MinNextBid tells a client whose bid failed how much it has to bid.
+	MinNextBid money.Amount `json:"min_next_bid,omitempty"`
+
+	// MaxAmount registers a private maximum on PlaceBid requests. It is
+	// never sent back to clients.
+	MaxAmount money.Amount `json:"max_amount,omitempty"`
+
+	// BoughtOutright is set on AuctionEnded when the product was sold at
+	// its buy now price.
+	BoughtOutright bool `json:"bought_outright,omitempty"`
+
+	// Reason explains why the seller cancelled or ended the auction early.
+	Reason string `json:"reason,omitempty"`
+
+	// Results ranks every bid of a sealed-bid auction on AuctionEnded.
+	Results []RankedBid `json:"results,omitempty"`
+
+	// Snapshot describes the auction on AuctionSnapshot.
+	Snapshot *RoomSnapshot `json:"snapshot,omitempty"`
+
+	// ServerTime is when the server sent an AuctionTick or TimeSyncReply,
+	// and ClientTime echoes the clock of the client on TimeSyncReply, so the
+	// client can estimate its clock offset and latency.
+	ServerTime *time.Time `json:"server_time,omitempty"`
+	ClientTime int64      `json:"client_time,omitempty"`
+
+	// SecondsRemaining counts down to AuctionEnd on AuctionTick.
+	SecondsRemaining *int64 `json:"seconds_remaining,omitempty"`
+
+	// payload is what the message was built from; requests have none.
+	payload Payload
+
+	// spectator marks requests sent by spectators, and client is the
+	// connection a request came from on this instance.
+	spectator bool
+	client    *Client
 }
 
+// reply builds the answer of kind to request, carrying payload.
+func reply(request Message, kind MessageKind, payload Payload) Message {
+	message := newMessage(kind, payload)
+	message.UserId = request.UserId
+	message.RequestID = request.RequestID
+	return message
+}
+
+// RoomSnapshot describes an auction to a client joining its room, built from
+// its AuctionState.
+type RoomSnapshot struct {
+	ProductID        uuid.UUID           `json:"product_id"`
+	ProductName      string              `json:"product_name"`
+	Description      string              `json:"description"`
+	SellerID         uuid.UUID           `json:"seller_id"`
+	AuctionType      pgstore.AuctionType `json:"auction_type"`
+	Currency         money.Currency      `json:"currency"`
+	BasePrice        money.Amount        `json:"base_price"`
+	BuyNowPrice      *money.Amount       `json:"buy_now_price,omitempty"`
+	AuctionStart     time.Time           `json:"auction_start"`
+	AuctionEnd       time.Time           `json:"auction_end"`
+	SecondsRemaining int64               `json:"seconds_remaining"`
+	HighestBid       money.Amount        `json:"highest_bid,omitempty"`
+	MinNextBid       money.Amount        `json:"min_next_bid"`
+	BidCount         int                 `json:"bid_count"`
+	HasReserve       bool                `json:"has_reserve"`
+	ReserveMet       bool                `json:"reserve_met,omitempty"`
+	RecentBids       []RecentBid         `json:"recent_bids"`
+}
+
+func (s *RoomSnapshot) message() Message {
+	return Message{
+		Message:    "Auction snapshot",
+		BidAmount:  s.HighestBid,
+		MinNextBid: s.MinNextBid,
+		Currency:   s.Currency,
+		AuctionEnd: &s.AuctionEnd,
+		Snapshot:   s,
+	}
+}
+
+type RecentBid struct {
+	BidderID  uuid.UUID    `json:"bidder_id"`
+	BidAmount money.Amount `json:"bid_amount"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+func newRoomSnapshot(state AuctionState, auctionEnd time.Time) *RoomSnapshot {
+	product := state.Product
+	snapshot := &RoomSnapshot{
+		ProductID:        product.ID,
+		ProductName:      product.ProductName,
+		Description:      product.Description,
+		SellerID:         product.SellerID,
+		AuctionType:      product.AuctionType,
+		Currency:         product.Currency,
+		BasePrice:        product.BasePrice,
+		BuyNowPrice:      product.BuyNowPrice,
+		AuctionStart:     product.AuctionStart,
+		AuctionEnd:       auctionEnd,
+		SecondsRemaining: max(0, int64(time.Until(auctionEnd).Seconds())),
+		HighestBid:       state.HighestBid.BidAmount,
+		MinNextBid:       state.MinNextBid,
+		BidCount:         state.BidCount,
+		HasReserve:       product.ReservePrice != nil,
+		ReserveMet:       product.ReservePrice != nil && state.ReserveMet,
+		RecentBids:       make([]RecentBid, 0, len(state.RecentBids)),
+	}
+	for _, bid := range state.RecentBids {
+		snapshot.RecentBids = append(snapshot.RecentBids, RecentBid{
+			BidderID:  bid.BidderID,
+			BidAmount: bid.BidAmount,
+			CreatedAt: bid.CreatedAt,
+		})
+	}
+	return snapshot
+}
+
+// ErrSpectator rejects the bids of spectators.
+var ErrSpectator = errors.New("spectators cannot bid, log in to take part in the auction")
+
 type AuctionLobby struct {
 	sync.Mutex
 	Rooms map[uuid.UUID]*AuctionRoom
+
+	// MaxConnectionsPerUser caps the connections a user can hold to each
+	// room; zero means no cap.
+	MaxConnectionsPerUser int
+
+	// MaxSpectators caps the spectators of each room; zero means no cap.
+	MaxSpectators int
 }
 
+const (
+	// DefaultMaxConnectionsPerUser lets a user follow an auction from a few
+	// devices at once.
+	DefaultMaxConnectionsPerUser = 5
+
+	DefaultMaxSpectators = 1000
+)
+
 type AuctionRoom struct {
-	Id         uuid.UUID
-	Context    context.Context
-	Broadcast  chan Message
-	Register   chan *Client
-	Unregister chan *Client
-	Clients    map[uuid.UUID]*Client
+	Id           uuid.UUID
+	Context      context.Context
+	AuctionStart time.Time
+	AuctionEnd   time.Time
+	Broadcast    chan Message
+	Register     chan *Client
+	Unregister   chan *Client
+	Clients      map[*Client]struct{}
+
+	// MaxConnectionsPerUser caps the clients of a single user; zero means no
+	// cap.
+	MaxConnectionsPerUser int
+
+	// MaxSpectators caps the spectators, who are counted apart from the
+	// users; zero means no cap.
+	MaxSpectators int
 
 	BidsService BidsService
+
+	bus          EventBus
+	loadSnapshot func(ctx context.Context, auctionID uuid.UUID) (AuctionState, error)
+	snapshots    chan roomSnapshot
+	connections  map[uuid.UUID]int
+	spectators   int
+	epoch        string
+	seq          uint64
+	history      []RoomEvent
+	product      pgstore.Product
+	started      bool
+	deadline     *time.Timer
+	priceDrops   *time.Timer
+	closed       bool
+	done         chan struct{}
+
+	// settleFailures counts the failed attempts to settle the auction.
+	settleFailures int
+
+	// forwarded lists the requests handed over to the leader and not
+	// answered yet, oldest first. forwards fires when the oldest of them
+	// expires.
+	forwarded      []forwardedRequest
+	forwards       *time.Timer
+	forwardTimeout time.Duration
 }
 
 func (r *AuctionRoom) registerClient(client *Client) {
 	slog.Info("New user connected", "Client", client)
-	r.Clients[client.UserID] = client
+	switch {
+	case client.Spectator && r.MaxSpectators > 0 && r.spectators >= r.MaxSpectators:
+		slog.Info("Room has too many spectators", "Client", client)
+		client.close(websocket.CloseTryAgainLater, "too many spectators")
+		return
+	case !client.Spectator && r.MaxConnectionsPerUser > 0 && r.connections[client.UserID] >= r.MaxConnectionsPerUser:
+		slog.Info("User has too many connections", "Client", client)
+		client.close(websocket.ClosePolicyViolation, "too many connections")
+		return
+	}
+	r.Clients[client] = struct{}{}
+	if client.Spectator {
+		r.spectators++
+	} else {
+		r.connections[client.UserID]++
+	}
+	r.catchUp(client)
+}
+
+// historySize bounds the events a room keeps for clients that reconnect.
+const historySize = 256
+
+// catchUp sends a new client a snapshot of the auction, and a reconnecting
+// client the events it missed, or a snapshot when they are no longer all in
+// the history or were numbered by another room, such as the room of another
+// instance or one open before a restart.
+func (r *AuctionRoom) catchUp(client *Client) {
+	if client.LastSeq == 0 || client.LastEpoch != r.epoch || !r.replay(client, client.LastSeq) {
+		r.requestSnapshot(client)
+	}
+}
+
+// replay sends client the events meant for it that were numbered after seq.
+// It reports false, sending nothing, when they are no longer all in the
+// history.
+func (r *AuctionRoom) replay(client *Client, seq uint64) bool {
+	if seq > r.seq || seq < r.seq && seq+1 < r.history[0].Message.Seq {
+		return false
+	}
+	for _, event := range r.history {
+		if event.Message.Seq <= seq || !event.isFor(client.UserID) {
+			continue
+		}
+		if !client.send(event.Message) {
+			r.disconnectClient(client)
+			break
+		}
+	}
+	return true
+}
+
+// roomSnapshot is the state of an auction loaded for a client, as of the
+// event numbered seq or later.
+type roomSnapshot struct {
+	client *Client
+	seq    uint64
+	state  AuctionState
+	err    error
+}
+
+// requestSnapshot loads the state of the auction for client without holding
+// up the room. The client gets no events until the snapshot is sent.
+func (r *AuctionRoom) requestSnapshot(client *Client) {
+	client.pending = true
+	seq := r.seq
+	go func() {
+		state, err := r.loadSnapshot(r.Context, r.Id)
+		select {
+		case r.snapshots <- roomSnapshot{client: client, seq: seq, state: state, err: err}:
+		case <-r.done:
+		}
+	}()
+}
+
+// sendSnapshot tells the client of snapshot where the auction stands, then
+// replays the events delivered while it was loading, which it may already
+// include.
+func (r *AuctionRoom) sendSnapshot(snapshot roomSnapshot) {
+	client := snapshot.client
+	if _, ok := r.Clients[client]; !ok {
+		return
+	}
+	if snapshot.err != nil {
+		slog.Error("failed to load auction snapshot", "Room", r.Id, "Error", snapshot.err)
+	} else {
+		message := newMessage(AuctionSnapshot, newRoomSnapshot(snapshot.state, r.AuctionEnd))
+		message.Seq, message.Epoch = snapshot.seq, r.epoch
+		if !client.send(message) {
+			r.disconnectClient(client)
+			return
+		}
+	}
+	if !r.replay(client, snapshot.seq) {
+		r.requestSnapshot(client)
+		return
+	}
+	client.pending = false
 }
 
 func (r *AuctionRoom) unregisterClient(client *Client) {
 	slog.Info("User disconnected", "Client", client)
-	delete(r.Clients, client.UserID)
+	r.removeClient(client)
+}
+
+// disconnectClient drops a client that fell too far behind and has its
+// connection closed. Clients that already left the room are not closed
+// again.
+func (r *AuctionRoom) disconnectClient(client *Client) {
+	if r.removeClient(client) {
+		client.close(websocket.CloseTryAgainLater, "client is too slow")
+	}
+}
+
+// removeClient reports whether client was still connected to the room.
+func (r *AuctionRoom) removeClient(client *Client) bool {
+	if _, ok := r.Clients[client]; !ok {
+		return false
+	}
+	delete(r.Clients, client)
+	if client.Spectator {
+		r.spectators--
+		return true
+	}
+	r.connections[client.UserID]--
+	if r.connections[client.UserID] == 0 {
+		delete(r.connections, client.UserID)
+	}
+	return true
+}
+
+// sendToAll delivers message to every client connected to the room on this
+// instance.
+func (r *AuctionRoom) sendToAll(message Message) {
+	r.deliver(RoomEvent{Message: message})
+}
+
+// sendToUser delivers message to userID when they are connected to the room
+// on this instance.
+func (r *AuctionRoom) sendToUser(userID uuid.UUID, message Message) {
+	r.deliver(RoomEvent{Message: message, To: &userID})
+}
+
+// deliver numbers event and sends its message to the clients of the room on
+// this instance it is meant for.
+func (r *AuctionRoom) deliver(event RoomEvent) {
+	r.seq++
+	event.Message.Seq, event.Message.Epoch = r.seq, r.epoch
+	r.history = append(r.history, event)
+	if len(r.history) > historySize {
+		r.history = r.history[len(r.history)-historySize:]
+	}
+
+	for client := range r.Clients {
+		// clients waiting for a snapshot get the event replayed after it,
+		// unless it closes the room and no snapshot will follow
+		if client.pending && !event.Close || !event.isFor(client.UserID) {
+			continue
+		}
+		if !client.send(event.Message) {
+			r.disconnectClient(client)
+		}
+	}
+}
+
+// publishToAll delivers message to every client of the room, whichever
+// instance they are connected to.
+func (r *AuctionRoom) publishToAll(message Message) {
+	r.publish(RoomEvent{Message: message})
+}
+
+// publishToUser delivers message to userID, whichever instance they are
+// connected to.
+func (r *AuctionRoom) publishToUser(userID uuid.UUID, message Message) {
+	r.publish(RoomEvent{Message: message, To: &userID})
+}
+
+// publish hands event to the bus. The room delivers it to its clients, like
+// every other subscriber, once it comes back from the bus.
+func (r *AuctionRoom) publish(event RoomEvent) {
+	if err := r.bus.Publish(r.Context, r.Id, event); err != nil {
+		slog.Error("failed to publish room event", "Room", r.Id, "Error", err)
+	}
+}
+
+// forwardedRequestTimeout bounds how long a room waits for the leader of its
+// auction to answer a forwarded request, as no instance may lead it for a
+// while, such as when the leader goes away.
+const forwardedRequestTimeout = 10 * time.Second
+
+// forwardedRequest is a client request handed over to the leader.
+type forwardedRequest struct {
+	message Message
+	expires time.Time
+}
+
+// forward hands a client request over to the room of the leader of the
+// auction. The client is told the request failed unless the leader answers
+// it in time.
+func (r *AuctionRoom) forward(message Message) {
+	err := r.bus.Publish(r.Context, r.Id, RoomEvent{Message: message, Request: true})
+	if err != nil {
+		slog.Error("failed to forward request to the leader", "Room", r.Id, "Error", err)
+		r.rejectForwarded(message)
+		return
+	}
+	r.forwarded = append(r.forwarded, forwardedRequest{
+		message: message,
+		expires: time.Now().Add(r.forwardTimeout),
+	})
+	if len(r.forwarded) == 1 {
+		r.forwards.Reset(r.forwardTimeout)
+	}
+}
+
+// rejectForwarded tells the client of a forwarded request that it failed.
+func (r *AuctionRoom) rejectForwarded(message Message) {
+	failed := FailedToPlaceBid
+	if message.Kind == BuyNow {
+		failed = FailedToBuyNow
+	}
+	r.sendToUser(message.UserId, reply(message, failed, RejectionPayload{
+		Error: "bid could not be processed, please try again",
+	}))
+}
+
+// answered stops waiting on the forwarded request event answers. The leader
+// answers every request with a single message to its user carrying its
+// request ID, unless it closes the auction.
+func (r *AuctionRoom) answered(event RoomEvent) {
+	switch event.Message.Kind {
+	case SuccessfullyPlacedBid, FailedToPlaceBid, FailedToBuyNow:
+	default:
+		return
+	}
+	for i, request := range r.forwarded {
+		if event.To != nil && request.message.UserId == *event.To && request.message.RequestID == event.Message.RequestID {
+			r.forwarded = append(r.forwarded[:i], r.forwarded[i+1:]...)
+			return
+		}
+	}
+}
+
+// expireForwarded rejects the forwarded requests the leader did not answer
+// in time. An answer arriving later still reaches the client.
+func (r *AuctionRoom) expireForwarded() {
+	now := time.Now()
+	for len(r.forwarded) > 0 && !r.forwarded[0].expires.After(now) {
+		request := r.forwarded[0]
+		r.forwarded = r.forwarded[1:]
+		slog.Info("Leader did not answer a forwarded request", "Room", r.Id, "UserId", request.message.UserId)
+		r.rejectForwarded(request.message)
+	}
+	if len(r.forwarded) > 0 {
+		r.forwards.Reset(time.Until(r.forwarded[0].expires))
+	}
+}
+
+// handleEvent applies an event consumed from the bus.
+func (r *AuctionRoom) handleEvent(event RoomEvent) {
+	if event.Request {
+		if r.bus.IsLeader(r.Id) {
+			r.broadcastMessage(event.Message)
+		}
+		return
+	}
+
+	r.answered(event)
+	r.deliver(event)
+	if event.Message.Kind == AuctionExtended && event.Message.AuctionEnd != nil {
+		r.AuctionEnd = *event.Message.AuctionEnd
+		r.deadline.Reset(time.Until(r.AuctionEnd))
+	}
+	if event.Close {
+		r.closed = true
+	}
 }
 
 func (r *AuctionRoom) broadcastMessage(message Message) {
 	slog.Info("Broadcasting message", "Room", r.Id, "Message", message, "UserId", message.UserId)
+	if _, ok := r.Clients[message.client]; message.client != nil && !ok {
+		// connections turned away by the room, or dropped by it, keep
+		// reading until they notice
+		slog.Info("Ignoring request of a disconnected client", "Room", r.Id, "UserId", message.UserId)
+		return
+	}
+	switch message.Kind {
+	case PlaceBid, BuyNow, AcceptPrice:
+		failed := FailedToPlaceBid
+		if message.Kind == BuyNow {
+			failed = FailedToBuyNow
+		}
+		if message.spectator {
+			r.sendToUser(message.UserId, reply(message, failed, RejectionPayload{
+				Error: ErrSpectator.Error(),
+			}))
+			return
+		}
+		if !r.started {
+			r.publishToUser(message.UserId, reply(message, failed, RejectionPayload{
+				Error: ErrAuctionNotStarted.Error(),
+			}))
+			return
+		}
+		if !r.bus.IsLeader(r.Id) {
+			r.forward(message)
+			return
+		}
+	}
+
 	switch message.Kind {
 	case PlaceBid:
-		bid, err := r.BidsService.PlaceBid(r.Context, r.Id, message.UserId, message.BidAmount)
+		var placed PlacedBids
+		var err error
+		if message.MaxAmount > 0 {
+			placed, err = r.BidsService.PlaceMaxBid(r.Context, r.Id, message.UserId, message.MaxAmount, message.Currency)
+		} else {
+			placed, err = r.BidsService.PlaceBid(r.Context, r.Id, message.UserId, message.BidAmount, message.Currency)
+		}
 		if err != nil {
-			if errors.Is(err, ErrBidAmountTooLow) {
-				if client, ok := r.Clients[message.UserId]; ok {
-					client.Send <- Message{
-						Message: ErrBidAmountTooLow.Error(),
-						Kind:    FailedToPlaceBid,
-						UserId:  message.UserId,
-					}
-					return
-				}
-			}
-			if client, ok := r.Clients[message.UserId]; ok {
-				client.Send <- Message{
-					Message: err.Error(),
-					Kind:    FailedToPlaceBid,
-					UserId:  message.UserId,
-				}
+			rejection := RejectionPayload{Error: err.Error()}
+			var tooLow *BidTooLowError
+			if errors.As(err, &tooLow) {
+				rejection.MinNextBid = tooLow.MinNextBid
+				rejection.Currency = tooLow.Currency
 			}
+			r.publishToUser(message.UserId, reply(message, FailedToPlaceBid, rejection))
+			return
 		}
-		if client, ok := r.Clients[message.UserId]; ok {
-			client.Send <- Message{
-				Message: fmt.Sprintf("Your bid of %.2f was placed successfully", bid.BidAmount),
-				Kind:    SuccessfullyPlacedBid,
-				UserId:  message.UserId,
-			}
+		if message.MaxAmount > 0 {
+			r.publishToUser(message.UserId, reply(message, SuccessfullyPlacedBid, BidPayload{
+				BidderID: message.UserId,
+				Message:  "Your maximum bid was registered successfully",
+			}))
 		}
-		for id, client := range r.Clients {
-			newBidMessage := Message{
-				UserId:    message.UserId,
-				Message:   fmt.Sprintf("New bid of %.2f was placed by %s", bid.BidAmount, id),
-				Kind:      NewBidPlaced,
-				BidAmount: bid.BidAmount,
-			}
-			if id == message.UserId {
-				continue
-			}
-			client.Send <- newBidMessage
+		if placed.Sealed {
+			r.publishToUser(message.UserId, reply(message, SuccessfullyPlacedBid, BidPayload{
+				BidderID: message.UserId,
+				Amount:   placed.Bids[0].BidAmount,
+				Currency: placed.Currency,
+				Message:  fmt.Sprintf("Your sealed bid of %s was recorded successfully", placed.Currency.Format(placed.Bids[0].BidAmount)),
+			}))
+			return
+		}
+		for _, bid := range placed.Bids {
+			r.announceBid(bid, message.MaxAmount == 0 && bid.BidderID == message.UserId, message.RequestID)
+		}
+		if placed.HasReserve {
+			r.announceReserve(placed.ReserveMet)
+		}
+		if placed.Extended {
+			r.extend(placed.AuctionEnd)
 		}
+	case BuyNow:
+		result, err := r.BidsService.BuyNow(r.Context, r.Id, message.UserId)
+		if err != nil {
+			r.publishToUser(message.UserId, reply(message, FailedToBuyNow, RejectionPayload{
+				Error: err.Error(),
+			}))
+			return
+		}
+		slog.Info("Auction has been bought outright", "Room", r.Id, "UserId", message.UserId)
+		r.closeAuction(AuctionEndedMessage(result))
+	case AcceptPrice:
+		result, err := r.BidsService.AcceptDutchPrice(r.Context, r.Id, message.UserId)
+		if err != nil {
+			r.publishToUser(message.UserId, reply(message, FailedToPlaceBid, RejectionPayload{
+				Error: err.Error(),
+			}))
+			return
+		}
+		slog.Info("Dutch auction price has been accepted", "Room", r.Id, "UserId", message.UserId)
+		r.closeAuction(AuctionEndedMessage(result))
+	case TimeSync:
+		// only answer clients still connected to the room
+		if _, ok := r.Clients[message.client]; !ok {
+			return
+		}
+		now := time.Now()
+		r.sendTransient(message.client, reply(message, TimeSyncReply, TimeSyncReplyPayload{
+			ServerTime: &now,
+			ClientTime: message.ClientTime,
+		}))
 	case InvalidJson:
-		client, ok := r.Clients[message.UserId]
-		if !ok {
+		if r.connections[message.UserId] == 0 && !message.spectator {
 			slog.Info("User not found", "UserId", message.UserId)
 			return
 		}
-		client.Send <- Message{
-			Message: "Invalid JSON",
-			Kind:    InvalidJson,
-			UserId:  message.UserId,
+		r.sendToUser(message.UserId, reply(message, InvalidJson, RejectionPayload{
+			Error: message.Message,
+		}))
+	}
+}
+
+const (
+	tickPeriod = 10 * time.Second
+
+	// finalTickPeriod applies to the final minute of an auction.
+	finalTickPeriod = time.Second
+)
+
+// nextTick returns how long to wait for the next AuctionTick.
+func (r *AuctionRoom) nextTick() time.Duration {
+	if time.Until(r.AuctionEnd) <= time.Minute {
+		return finalTickPeriod
+	}
+	return tickPeriod
+}
+
+// tick tells every client of this instance the server time and how long the
+// auction has left.
+func (r *AuctionRoom) tick() {
+	now := time.Now()
+	auctionEnd := r.AuctionEnd
+	remaining := int64(math.Ceil(max(0, auctionEnd.Sub(now).Seconds())))
+	message := newMessage(AuctionTick, TickPayload{
+		ServerTime:       &now,
+		AuctionEnd:       &auctionEnd,
+		SecondsRemaining: &remaining,
+	})
+	for client := range r.Clients {
+		r.sendTransient(client, message)
+	}
+}
+
+// sendTransient sends message to client without numbering it or keeping it
+// in the history, as it is outdated by the time a client could replay it.
+func (r *AuctionRoom) sendTransient(client *Client, message Message) {
+	if !client.send(message) {
+		r.disconnectClient(client)
+	}
+}
+
+// announceBid confirms bid to its bidder and tells every other client about
+// it. Bids that the bidder did not place themselves were placed on their
+// behalf by their maximum bid; the others answer the request requestID.
+func (r *AuctionRoom) announceBid(bid pgstore.Bid, placedByBidder bool, requestID string) {
+	confirmation := BidPayload{
+		BidderID: bid.BidderID,
+		Amount:   bid.BidAmount,
+		Currency: r.product.Currency,
+		Message:  fmt.Sprintf("Your bid of %s was placed successfully", r.product.Currency.Format(bid.BidAmount)),
+	}
+	if !placedByBidder {
+		confirmation.Message = fmt.Sprintf("A bid of %s was placed on your behalf", r.product.Currency.Format(bid.BidAmount))
+		requestID = ""
+	}
+	confirmed := newMessage(SuccessfullyPlacedBid, confirmation)
+	confirmed.RequestID = requestID
+	r.publishToUser(bid.BidderID, confirmed)
+	r.publish(RoomEvent{
+		Message: newMessage(NewBidPlaced, BidPayload{
+			BidderID: bid.BidderID,
+			Amount:   bid.BidAmount,
+			Currency: r.product.Currency,
+			Message:  fmt.Sprintf("New bid of %s was placed by %s", r.product.Currency.Format(bid.BidAmount), bid.BidderID),
+		}),
+		Except: &bid.BidderID,
+	})
+}
+
+// announceReserve tells every client whether the leading bid meets the
+// hidden reserve price.
+func (r *AuctionRoom) announceReserve(met bool) {
+	r.publishToAll(ReserveStatusMessage(met))
+}
+
+// ReserveStatusMessage tells clients whether the leading bid meets the hidden
+// reserve price.
+func ReserveStatusMessage(met bool) Message {
+	if met {
+		return newMessage(ReserveMet, NoticePayload{Message: "Reserve price has been met"})
+	}
+	return newMessage(ReserveNotMet, NoticePayload{Message: "Reserve price has not been met"})
+}
+
+// BidRetractedMessage tells clients a bid was retracted or voided and which
+// bid leads the auction now.
+func BidRetractedMessage(retracted RetractedBid, reason string) Message {
+	currency := retracted.Currency
+	message := fmt.Sprintf("Bid of %s by %s was retracted, there are no bids left", currency.Format(retracted.Bid.BidAmount), retracted.Bid.BidderID)
+	if retracted.LeadingBid.BidAmount > 0 {
+		message = fmt.Sprintf("Bid of %s by %s was retracted, leading bid is now %s", currency.Format(retracted.Bid.BidAmount), retracted.Bid.BidderID, currency.Format(retracted.LeadingBid.BidAmount))
+	}
+	return newMessage(BidRetracted, BidRetractedPayload{
+		BidderID:   retracted.Bid.BidderID,
+		LeadingBid: retracted.LeadingBid.BidAmount,
+		MinNextBid: retracted.MinNextBid,
+		Currency:   currency,
+		Reason:     reason,
+		Message:    message,
+	})
+}
+
+// start opens bidding and lets every client know the auction has started.
+func (r *AuctionRoom) start() {
+	slog.Info("Auction has started", "Room", r.Id)
+	r.started = true
+	auctionEnd := r.AuctionEnd
+	payload := PricePayload{
+		AuctionEnd: &auctionEnd,
+		Message:    "Auction has started",
+	}
+	if r.product.AuctionType == pgstore.AuctionTypeDutch {
+		payload.Price = DutchPrice(r.product, time.Now())
+		payload.Currency = r.product.Currency
+	}
+	r.sendToAll(newMessage(AuctionStarted, payload))
+}
+
+// dropPrice tells every client the current price of a Dutch auction and
+// schedules the next drop.
+func (r *AuctionRoom) dropPrice() {
+	now := time.Now()
+	price := DutchPrice(r.product, now)
+	r.sendToAll(newMessage(PriceUpdated, PricePayload{
+		Price:    price,
+		Currency: r.product.Currency,
+		Message:  fmt.Sprintf("Current price is %s", r.product.Currency.Format(price)),
+	}))
+	r.priceDrops.Reset(NextDutchPriceDrop(r.product, now).Sub(now))
+}
+
+// extend lets every client know about the new end of the auction after a
+// late bid. The deadline of every room is pushed once the event comes back
+// from the bus.
+func (r *AuctionRoom) extend(auctionEnd time.Time) {
+	slog.Info("Auction has been extended", "Room", r.Id, "AuctionEnd", auctionEnd)
+	r.publishToAll(newMessage(AuctionExtended, AuctionExtendedPayload{
+		AuctionEnd: &auctionEnd,
+		Message:    fmt.Sprintf("Auction has been extended until %s", auctionEnd.Format(time.RFC3339)),
+	}))
+}
+
+// AuctionEndedMessage describes the outcome of an auction to its clients.
+func AuctionEndedMessage(result AuctionResult) Message {
+	payload := auctionEndedPayload(result)
+	payload.Reason = result.Reason
+	payload.Results = result.Ranking
+	if payload.FinalPrice > 0 || len(payload.Results) > 0 {
+		payload.Currency = result.Currency
+	}
+	return newMessage(AuctionEnded, payload)
+}
+
+func auctionEndedPayload(result AuctionResult) AuctionEndedPayload {
+	switch {
+	case result.EndedEarly:
+		return AuctionEndedPayload{
+			WinnerID:   &result.WinnerID,
+			FinalPrice: result.FinalPrice,
+			Message:    fmt.Sprintf("Auction has been ended early by the seller, won by %s with a bid of %s", result.WinnerID, result.Currency.Format(result.FinalPrice)),
+		}
+	case result.BoughtOutright:
+		return AuctionEndedPayload{
+			WinnerID:       &result.WinnerID,
+			FinalPrice:     result.FinalPrice,
+			BoughtOutright: true,
+			Message:        fmt.Sprintf("Auction has ended, bought outright by %s for %s", result.WinnerID, result.Currency.Format(result.FinalPrice)),
+		}
+	case result.Sold:
+		return AuctionEndedPayload{
+			WinnerID:   &result.WinnerID,
+			FinalPrice: result.FinalPrice,
+			Message:    fmt.Sprintf("Auction has ended, won by %s with a bid of %s", result.WinnerID, result.Currency.Format(result.FinalPrice)),
+		}
+	case result.ReserveNotMet:
+		return AuctionEndedPayload{Message: "Auction has ended, reserve price was not met"}
+	default:
+		return AuctionEndedPayload{Message: "Auction has ended without bids"}
+	}
+}
+
+// AuctionCancelledMessage tells clients the seller pulled the auction.
+func AuctionCancelledMessage(reason string) Message {
+	return newMessage(AuctionCancelled, AuctionCancelledPayload{
+		Reason:  reason,
+		Message: "Auction has been cancelled by the seller",
+	})
+}
+
+// closeAuction publishes the final message of the auction, which stops every
+// room of it once delivered.
+func (r *AuctionRoom) closeAuction(message Message) {
+	r.publish(RoomEvent{Message: message, Close: true})
+}
+
+const (
+	settleTimeout = 10 * time.Second
+
+	// settleRetry is how long a room waits to settle its auction again after
+	// failing to, doubling on every failure up to maxSettleRetry.
+	settleRetry    = time.Second
+	maxSettleRetry = time.Minute
+)
+
+// settle closes the auction once it is over. Failures leave the auction open
+// and are retried, unless the auction was closed some other way, and
+// auctions extended in the meantime wait for their new end.
+func (r *AuctionRoom) settle() {
+	ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+
+	result, err := r.BidsService.SettleAuction(ctx, r.Id)
+	var extended *AuctionExtendedError
+	switch {
+	case errors.As(err, &extended):
+		r.AuctionEnd = extended.AuctionEnd
+		r.deadline.Reset(time.Until(r.AuctionEnd))
+		r.extend(extended.AuctionEnd)
+	case errors.Is(err, ErrAuctionEnded), errors.Is(err, ErrProductNotFound):
+		slog.Info("Auction was already closed", "Room", r.Id, "Error", err)
+		r.closeAuction(newMessage(AuctionEnded, AuctionEndedPayload{Message: "Auction has ended"}))
+	case err != nil:
+		retry := min(settleRetry<<r.settleFailures, maxSettleRetry)
+		if retry < maxSettleRetry {
+			r.settleFailures++
 		}
+		slog.Error("failed to settle auction", "Room", r.Id, "Error", err, "Retry", retry)
+		r.deadline.Reset(retry)
+	default:
+		r.closeAuction(AuctionEndedMessage(result))
+	}
+}
+
+// checkClosed stops a room waiting for its auction to be settled by another
+// instance once the auction is closed, in case the closing event never
+// reached it.
+func (r *AuctionRoom) checkClosed() {
+	ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+
+	product, err := r.BidsService.GetProduct(ctx, r.Id)
+	switch {
+	case err != nil:
+		slog.Error("failed to check whether auction is closed", "Room", r.Id, "Error", err)
+	case product.ClosedAt.Valid:
+		slog.Info("Auction was closed by another instance", "Room", r.Id)
+		r.handleEvent(RoomEvent{Message: ClosedAuctionMessage(product), Close: true})
 	}
 }
 
+// ClosedAuctionMessage describes the outcome of a closed auction as recorded
+// on product. Unlike the message sent when it closed, it leaves out the
+// ranking of sealed-bid auctions.
+func ClosedAuctionMessage(product pgstore.Product) Message {
+	kind := product.CloseKind.CloseKind
+	if kind == pgstore.CloseKindCancelled {
+		return AuctionCancelledMessage(product.CloseReason)
+	}
+	result := AuctionResult{
+		Sold:           product.IsSold,
+		Currency:       product.Currency,
+		ReserveNotMet:  kind == pgstore.CloseKindReserveNotMet,
+		BoughtOutright: kind == pgstore.CloseKindBoughtOutright,
+		EndedEarly:     kind == pgstore.CloseKindEndedEarly,
+		Reason:         product.CloseReason,
+	}
+	if product.WinnerID != nil {
+		result.WinnerID = *product.WinnerID
+	}
+	if product.FinalPrice != nil {
+		result.FinalPrice = *product.FinalPrice
+	}
+	return AuctionEndedMessage(result)
+}
+
 func (r *AuctionRoom) Run() {
-	slog.Info("Auction has started", "Room:", r.Id)
+	slog.Info("Auction room is open", "Room", r.Id, "AuctionStart", r.AuctionStart)
+	r.deadline = time.NewTimer(time.Until(r.AuctionEnd))
+	starting := time.NewTimer(time.Until(r.AuctionStart))
+	ticks := time.NewTimer(r.nextTick())
+	r.forwards = time.NewTimer(r.forwardTimeout)
+	r.forwards.Stop()
 	defer func() {
-		close(r.Broadcast)
-		close(r.Register)
-		close(r.Unregister)
+		starting.Stop()
+		ticks.Stop()
+		r.deadline.Stop()
+		r.forwards.Stop()
+		close(r.done)
 	}()
+	events, unsubscribe := r.bus.Subscribe(r.Id)
+	defer unsubscribe()
 
-	for {
+	var priceDrops <-chan time.Time
+	if r.product.AuctionType == pgstore.AuctionTypeDutch {
+		r.priceDrops = time.NewTimer(time.Until(NextDutchPriceDrop(r.product, time.Now())))
+		defer r.priceDrops.Stop()
+		priceDrops = r.priceDrops.C
+	}
+
+	for !r.closed {
 		select {
 		case client := <-r.Register:
 			r.registerClient(client)
@@ -136,47 +963,127 @@ func (r *AuctionRoom) Run() {
 			r.unregisterClient(client)
 		case message := <-r.Broadcast:
 			r.broadcastMessage(message)
-		case <-r.Context.Done():
-			slog.Info("Auction has ended", "Room", r.Id)
-			for _, client := range r.Clients {
-				client.Send <- Message{
-					Message: "Auction has ended",
-					Kind:    AuctionEnded,
-				}
-				return
+		case event := <-events:
+			r.handleEvent(event)
+		case snapshot := <-r.snapshots:
+			r.sendSnapshot(snapshot)
+		case <-starting.C:
+			r.start()
+		case <-priceDrops:
+			r.dropPrice()
+		case <-ticks.C:
+			r.tick()
+			ticks.Reset(r.nextTick())
+		case <-r.forwards.C:
+			r.expireForwarded()
+		case <-r.deadline.C:
+			if !r.bus.IsLeader(r.Id) {
+				// the leader settles the auction, unless it goes away
+				r.checkClosed()
+				r.deadline.Reset(leaderRetry)
+				continue
 			}
+			slog.Info("Auction has ended", "Room", r.Id)
+			r.settle()
+		case <-r.Context.Done():
+			slog.Info("Auction room has been stopped", "Room", r.Id)
+			return
 		}
 	}
 }
 
-func NewAuctionRoom(ctx context.Context, id uuid.UUID, bidsService BidsService) *AuctionRoom {
+// NewAuctionRoom creates the room of product, which publishes and consumes
+// its events through bus.
+func NewAuctionRoom(ctx context.Context, product pgstore.Product, bidsService BidsService, bus EventBus) *AuctionRoom {
 	return &AuctionRoom{
-		Id:          id,
-		Context:     ctx,
-		Broadcast:   make(chan Message),
-		Register:    make(chan *Client),
-		Unregister:  make(chan *Client),
-		Clients:     make(map[uuid.UUID]*Client),
-		BidsService: bidsService,
+		Id:             product.ID,
+		Context:        ctx,
+		AuctionStart:   product.AuctionStart,
+		AuctionEnd:     product.AuctionEnd,
+		Broadcast:      make(chan Message),
+		Register:       make(chan *Client),
+		Unregister:     make(chan *Client),
+		Clients:        make(map[*Client]struct{}),
+		BidsService:    bidsService,
+		bus:            bus,
+		loadSnapshot:   bidsService.AuctionState,
+		snapshots:      make(chan roomSnapshot),
+		connections:    make(map[uuid.UUID]int),
+		epoch:          uuid.NewString(),
+		product:        product,
+		done:           make(chan struct{}),
+		forwardTimeout: forwardedRequestTimeout,
 	}
 }
 
+// Join registers client with the room. It reports false when the room has
+// already stopped running, in which case client never gets any message.
+func (r *AuctionRoom) Join(client *Client) bool {
+	select {
+	case r.Register <- client:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// Client is a connection to a room. Conn is nil for clients following the
+// room through StreamEvents.
 type Client struct {
 	Room   *AuctionRoom
 	Conn   *websocket.Conn
 	Send   chan Message
 	UserID uuid.UUID
+	Policy SlowClientPolicy
+
+	// LastSeq is the last message a reconnecting client saw, in the epoch
+	// LastEpoch; zero for new clients.
+	LastSeq   uint64
+	LastEpoch string
+
+	// Version is the protocol version the client speaks; zero means
+	// ProtocolV1.
+	Version int
+
+	// Spectator marks anonymous clients, which only watch the auction. Each
+	// one gets a UserID of its own.
+	Spectator bool
+
+	// pending marks clients waiting for a snapshot of the auction.
+	pending bool
+
+	disconnect chan struct{}
+	closeCode  int
+	closeText  string
 }
 
-func NewClient(room *AuctionRoom, conn *websocket.Conn, userID uuid.UUID) *Client {
+func NewClient(room *AuctionRoom, conn *websocket.Conn, userID uuid.UUID, policy SlowClientPolicy, lastSeq uint64) *Client {
 	return &Client{
-		Room:   room,
-		Conn:   conn,
-		Send:   make(chan Message, 512),
-		UserID: userID,
+		Room:       room,
+		Conn:       conn,
+		Send:       make(chan Message, 512),
+		UserID:     userID,
+		Policy:     policy,
+		LastSeq:    lastSeq,
+		disconnect: make(chan struct{}),
 	}
 }
 
+// close has the connection of the client closed with code. It must only be
+// called once, by the room.
+func (c *Client) close(code int, text string) {
+	c.closeCode, c.closeText = code, text
+	close(c.disconnect)
+}
+
+// NewSpectator creates an anonymous client that can watch the room but not
+// bid.
+func NewSpectator(room *AuctionRoom, conn *websocket.Conn, policy SlowClientPolicy, lastSeq uint64) *Client {
+	client := NewClient(room, conn, uuid.New(), policy, lastSeq)
+	client.Spectator = true
+	return client
+}
+
 const (
 	maxMessageSize = 512
 	readDeadLine   = 60 * time.Second
@@ -184,9 +1091,18 @@ const (
 	writeWait      = 10 * time.Second
 )
 
+// unregister removes the client from its room, unless the room has already
+// stopped running.
+func (c *Client) unregister() {
+	select {
+	case c.Room.Unregister <- c:
+	case <-c.Room.done:
+	}
+}
+
 func (c *Client) ReadEventLoop() {
 	defer func() {
-		c.Room.Unregister <- c
+		c.unregister()
 		c.Conn.Close()
 	}()
 
@@ -197,22 +1113,34 @@ func (c *Client) ReadEventLoop() {
 		return nil
 	})
 	for {
-		var m Message
-		m.UserId = c.UserID
-		err := c.Conn.ReadJSON(&m)
+		_, data, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				slog.Error("unexpected close error", "Error", err)
-				return
 			}
-			c.Room.Broadcast <- Message{
-				Message: "Invalid JSON",
-				Kind:    InvalidJson,
-				UserId:  m.UserId,
+			return
+		}
+		m, err := c.decode(data)
+		if err != nil {
+			text := "Invalid JSON"
+			if c.Version == ProtocolV2 {
+				text = err.Error()
 			}
-			continue
+			m = Message{
+				Message:   text,
+				Kind:      InvalidJson,
+				RequestID: m.RequestID,
+			}
+		}
+		// requests always act on behalf of the connected user
+		m.UserId = c.UserID
+		m.spectator = c.Spectator
+		m.client = c
+		select {
+		case c.Room.Broadcast <- m:
+		case <-c.Room.done:
+			return
 		}
-		c.Room.Broadcast <- m
 	}
 }
 
@@ -233,16 +1161,25 @@ func (c *Client) WriteEventLoop() {
 				})
 				return
 			}
-			if message.Kind == AuctionEnded {
-				close(c.Send)
-				return
+			encoded, err := c.encode(message)
+			if err != nil {
+				slog.Error("failed to encode message", "Client", c, "Error", err)
+				continue
 			}
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			err := c.Conn.WriteJSON(message)
+			err = c.Conn.WriteJSON(encoded)
 			if err != nil {
-				c.Room.Unregister <- c
+				c.unregister()
 				return
 			}
+			if message.Kind == AuctionEnded || message.Kind == AuctionCancelled {
+				c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, message.Message))
+				return
+			}
+		case <-c.disconnect:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeText))
+			return
 		case <-ticker.C:
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
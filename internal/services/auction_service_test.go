@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/LucasLCabral/go-bid/internal/money"
+	"github.com/LucasLCabral/go-bid/internal/store/pgstore"
+	"github.com/google/uuid"
+)
+
+// newTestRoom returns the room of an english auction that started a minute
+// ago and ends in an hour. Its snapshots are built from the product alone,
+// so it never touches a database.
+func newTestRoom(bus EventBus) *AuctionRoom {
+	product := pgstore.Product{
+		ID:           uuid.New(),
+		SellerID:     uuid.New(),
+		ProductName:  "Test product",
+		BasePrice:    10 * money.Unit,
+		AuctionType:  pgstore.AuctionTypeEnglish,
+		AuctionStart: time.Now().Add(-time.Minute),
+		AuctionEnd:   time.Now().Add(time.Hour).Truncate(time.Second),
+		Currency:     "USD",
+	}
+	room := NewAuctionRoom(context.Background(), product, BidsService{}, bus)
+	room.loadSnapshot = func(ctx context.Context, auctionID uuid.UUID) (AuctionState, error) {
+		return AuctionState{Product: product, MinNextBid: MinNextBid(product, pgstore.Bid{})}, nil
+	}
+	return room
+}
+
+// runTestRoom runs room until the test ends.
+func runTestRoom(t *testing.T, room *AuctionRoom) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(room.Context)
+	room.Context = ctx
+	go room.Run()
+	t.Cleanup(func() {
+		cancel()
+		<-room.done
+	})
+}
+
+// join connects client to room.
+func join(t *testing.T, room *AuctionRoom, client *Client) {
+	t.Helper()
+	if !room.Join(client) {
+		t.Fatal("room has stopped")
+	}
+}
+
+// receive returns the next message of kind sent to client, skipping the
+// others.
+func receive(t *testing.T, client *Client, kind MessageKind) Message {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case message := <-client.Send:
+			if message.Kind == kind {
+				return message
+			}
+		case <-timeout:
+			t.Fatalf("client got no message of kind %d", kind)
+		}
+	}
+}
+
+// waitIdle waits for room to handle everything sent to it so far, by asking it
+// the time on behalf of client.
+func waitIdle(t *testing.T, room *AuctionRoom, client *Client) {
+	t.Helper()
+	room.Broadcast <- Message{Kind: TimeSync, UserId: client.UserID, RequestID: "sync", client: client}
+	for {
+		if reply := receive(t, client, TimeSyncReply); reply.RequestID == "sync" {
+			return
+		}
+	}
+}
+
+func TestRoomSendsSnapshotToNewClients(t *testing.T) {
+	room := newTestRoom(newRecordingEventBus())
+	runTestRoom(t, room)
+
+	client := NewClient(room, nil, uuid.New(), DropOldest, 0)
+	join(t, room, client)
+	snapshot := receive(t, client, AuctionSnapshot)
+	if snapshot.Snapshot == nil || snapshot.Snapshot.ProductID != room.Id {
+		t.Fatalf("snapshot = %+v", snapshot.Snapshot)
+	}
+	if snapshot.MinNextBid != 10*money.Unit+50*money.Cent {
+		t.Errorf("MinNextBid = %s", snapshot.MinNextBid)
+	}
+	if snapshot.Epoch == "" {
+		t.Error("snapshot has no epoch")
+	}
+}
+
+func TestRoomReplaysMissedEvents(t *testing.T) {
+	room := newTestRoom(newRecordingEventBus())
+	runTestRoom(t, room)
+
+	watcher := NewClient(room, nil, uuid.New(), DropOldest, 0)
+	join(t, room, watcher)
+	receive(t, watcher, AuctionSnapshot)
+	room.announceReserve(false)
+	missed := receive(t, watcher, ReserveNotMet)
+	room.announceReserve(true)
+	receive(t, watcher, ReserveMet)
+
+	t.Run("same epoch", func(t *testing.T) {
+		client := NewClient(room, nil, uuid.New(), DropOldest, missed.Seq)
+		client.LastEpoch = missed.Epoch
+		join(t, room, client)
+		select {
+		case message := <-client.Send:
+			if message.Kind != ReserveMet || message.Seq <= missed.Seq {
+				t.Fatalf("replayed %d #%d, want ReserveMet after #%d", message.Kind, message.Seq, missed.Seq)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("nothing was replayed")
+		}
+	})
+
+	t.Run("other epoch", func(t *testing.T) {
+		client := NewClient(room, nil, uuid.New(), DropOldest, missed.Seq)
+		client.LastEpoch = "another room"
+		join(t, room, client)
+		receive(t, client, AuctionSnapshot)
+	})
+}
+
+// A connection turned away by the connection cap keeps reading until it
+// notices, and a slow one may be disconnected twice over.
+func TestRoomIgnoresRequestsOfRejectedClients(t *testing.T) {
+	room := newTestRoom(newRecordingEventBus())
+	room.MaxConnectionsPerUser = 1
+	runTestRoom(t, room)
+
+	userID := uuid.New()
+	first := NewClient(room, nil, userID, DropOldest, 0)
+	join(t, room, first)
+	rejected := NewClient(room, nil, userID, DisconnectSlow, 0)
+	join(t, room, rejected)
+	select {
+	case <-rejected.disconnect:
+	case <-time.After(time.Second):
+		t.Fatal("connection over the cap was not closed")
+	}
+
+	// any reply would now disconnect it again
+	for len(rejected.Send) < cap(rejected.Send) {
+		rejected.Send <- Message{}
+	}
+	room.Broadcast <- Message{Kind: TimeSync, UserId: userID, client: rejected}
+	room.Broadcast <- Message{Kind: PlaceBid, UserId: userID, BidAmount: 20 * money.Unit, client: rejected}
+	waitIdle(t, room, first)
+}
+
+func TestRoomDisconnectsSlowClientsOnce(t *testing.T) {
+	room := newTestRoom(newRecordingEventBus())
+	runTestRoom(t, room)
+
+	slow := NewClient(room, nil, uuid.New(), DisconnectSlow, 0)
+	join(t, room, slow)
+	receive(t, slow, AuctionSnapshot)
+	for len(slow.Send) < cap(slow.Send) {
+		slow.Send <- Message{}
+	}
+	room.announceReserve(false)
+	room.announceReserve(true)
+	select {
+	case <-slow.disconnect:
+	case <-time.After(time.Second):
+		t.Fatal("slow client was not disconnected")
+	}
+	// a request still in flight from the dropped connection
+	room.Broadcast <- Message{Kind: TimeSync, UserId: slow.UserID, client: slow}
+
+	watcher := NewClient(room, nil, uuid.New(), DropOldest, 0)
+	join(t, room, watcher)
+	waitIdle(t, room, watcher)
+}
+
+// Messages outlive the room loop, so an extension must not change the end of
+// the auction they were sent with. Run with -race to catch them sharing it.
+func TestRoomMessagesKeepTheirAuctionEnd(t *testing.T) {
+	bus := newRecordingEventBus()
+	room := newTestRoom(bus)
+	end := room.AuctionEnd
+	runTestRoom(t, room)
+
+	client := NewClient(room, nil, uuid.New(), DropOldest, 0)
+	join(t, room, client)
+	snapshot := receive(t, client, AuctionSnapshot)
+
+	extended := end.Add(time.Minute)
+	room.extend(extended)
+	extension := receive(t, client, AuctionExtended)
+	waitIdle(t, room, client)
+
+	if !snapshot.AuctionEnd.Equal(end) {
+		t.Errorf("snapshot AuctionEnd = %s, want %s", snapshot.AuctionEnd, end)
+	}
+	if !extension.AuctionEnd.Equal(extended) {
+		t.Errorf("extension AuctionEnd = %s, want %s", extension.AuctionEnd, extended)
+	}
+}
+
+func TestRoomTellsSpectatorsTheyCannotBid(t *testing.T) {
+	bus := newRecordingEventBus()
+	room := newTestRoom(bus)
+	runTestRoom(t, room)
+
+	spectator := NewSpectator(room, nil, DropOldest, 0)
+	join(t, room, spectator)
+	room.Broadcast <- Message{
+		Kind:      PlaceBid,
+		UserId:    spectator.UserID,
+		BidAmount: 20 * money.Unit,
+		RequestID: "bid",
+		spectator: true,
+		client:    spectator,
+	}
+	failed := receive(t, spectator, FailedToPlaceBid)
+	if failed.Message != ErrSpectator.Error() || failed.RequestID != "bid" {
+		t.Errorf("failed = %+v", failed)
+	}
+	for _, event := range bus.Published() {
+		if event.Message.Kind == FailedToPlaceBid {
+			t.Error("rejection of a spectator was published to other instances")
+		}
+	}
+}
+
+// Rooms of instances that do not lead the auction forward bids to the
+// leader, which may not answer when no instance leads it.
+func TestRoomRejectsUnansweredForwardedRequests(t *testing.T) {
+	bus := newRecordingEventBus()
+	bus.leader = false
+	room := newTestRoom(bus)
+	room.forwardTimeout = 50 * time.Millisecond
+	runTestRoom(t, room)
+
+	client := NewClient(room, nil, uuid.New(), DropOldest, 0)
+	join(t, room, client)
+	bid := Message{Kind: PlaceBid, UserId: client.UserID, BidAmount: 20 * money.Unit, client: client}
+
+	bid.RequestID = "answered"
+	room.Broadcast <- bid
+	answer := Message{UserId: client.UserID, RequestID: "answered"}
+	bus.Publish(context.Background(), room.Id, RoomEvent{
+		Message: reply(answer, SuccessfullyPlacedBid, BidPayload{BidderID: client.UserID}),
+		To:      &client.UserID,
+	})
+	receive(t, client, SuccessfullyPlacedBid)
+
+	bid.RequestID = "lost"
+	room.Broadcast <- bid
+	failed := receive(t, client, FailedToPlaceBid)
+	if failed.RequestID != "lost" {
+		t.Errorf("rejected request %q, want lost", failed.RequestID)
+	}
+	waitIdle(t, room, client)
+	select {
+	case message := <-client.Send:
+		t.Errorf("unexpected %d for request %q", message.Kind, message.RequestID)
+	default:
+	}
+
+	forwarded := 0
+	for _, event := range bus.Published() {
+		if event.Request {
+			forwarded++
+		}
+	}
+	if forwarded != 2 {
+		t.Errorf("forwarded %d requests, want 2", forwarded)
+	}
+}
+
+func TestRoomClosesOnCloseEvent(t *testing.T) {
+	bus := newRecordingEventBus()
+	room := newTestRoom(bus)
+	runTestRoom(t, room)
+
+	client := NewClient(room, nil, uuid.New(), DropOldest, 0)
+	join(t, room, client)
+	bus.Publish(context.Background(), room.Id, RoomEvent{
+		Message: AuctionCancelledMessage("changed my mind"),
+		Close:   true,
+	})
+	cancelled := receive(t, client, AuctionCancelled)
+	if cancelled.Reason != "changed my mind" {
+		t.Errorf("Reason = %q", cancelled.Reason)
+	}
+	select {
+	case <-room.done:
+	case <-time.After(time.Second):
+		t.Fatal("room kept running")
+	}
+	if room.Join(NewClient(room, nil, uuid.New(), DropOldest, 0)) {
+		t.Error("stopped room accepted a client")
+	}
+}
+
+func TestClosedAuctionMessage(t *testing.T) {
+	winnerID := uuid.New()
+	price := 50 * money.Unit
+	closed := func(kind pgstore.CloseKind, reason string) pgstore.Product {
+		return pgstore.Product{
+			IsSold:      kind != pgstore.CloseKindNoBids && kind != pgstore.CloseKindReserveNotMet && kind != pgstore.CloseKindCancelled,
+			WinnerID:    &winnerID,
+			FinalPrice:  &price,
+			Currency:    "USD",
+			CloseKind:   pgstore.NullCloseKind{CloseKind: kind, Valid: true},
+			CloseReason: reason,
+			IsCancelled: kind == pgstore.CloseKindCancelled,
+		}
+	}
+
+	// the reason of the seller never decides how the auction closed
+	early := ClosedAuctionMessage(closed(pgstore.CloseKindEndedEarly, "bought outright"))
+	if early.Kind != AuctionEnded || early.BoughtOutright || early.Reason != "bought outright" {
+		t.Errorf("ended early = %+v", early)
+	}
+	bought := ClosedAuctionMessage(closed(pgstore.CloseKindBoughtOutright, ""))
+	if !bought.BoughtOutright || bought.UserId != winnerID || bought.BidAmount != price {
+		t.Errorf("bought outright = %+v", bought)
+	}
+	unsold := ClosedAuctionMessage(closed(pgstore.CloseKindReserveNotMet, ""))
+	if unsold.Message != "Auction has ended, reserve price was not met" {
+		t.Errorf("reserve not met = %+v", unsold)
+	}
+	cancelled := ClosedAuctionMessage(closed(pgstore.CloseKindCancelled, "reserve price not met"))
+	if cancelled.Kind != AuctionCancelled || cancelled.Reason != "reserve price not met" {
+		t.Errorf("cancelled = %+v", cancelled)
+	}
+}
@@ -3,10 +3,15 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/LucasLCabral/go-bid/internal/money"
 	"github.com/LucasLCabral/go-bid/internal/store/pgstore"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -22,35 +27,986 @@ func NewBidsService(pool *pgxpool.Pool) *BidsService {
 	}
 }
 
-var ErrBidAmountTooLow = errors.New("bid amount must be greater than the base price and the highest bid")
+var (
+	ErrBidAmountTooLow   = errors.New("bid amount must be greater than the base price and the highest bid")
+	ErrMaxBidTooLow      = errors.New("maximum bid must be greater than the base price and the highest bid")
+	ErrAuctionNotStarted = errors.New("auction has not started yet")
+	ErrAuctionEnded      = errors.New("auction has ended")
+	ErrAuctionNotOver    = errors.New("auction has not ended yet")
+	ErrBuyNowUnavailable = errors.New("product can no longer be bought outright")
+	ErrDutchAuction      = errors.New("dutch auctions only accept the current price")
+	ErrNotDutchAuction   = errors.New("product is not a dutch auction")
+	ErrMaxBidUnavailable = errors.New("maximum bids are only available on english auctions")
+	ErrNotSeller         = errors.New("only the seller can close this auction")
+	ErrNoBids            = errors.New("auction has no bids to accept")
+	ErrBidNotFound       = errors.New("bid not found")
+	ErrNotBidder         = errors.New("only the bidder can retract this bid")
+	ErrRetractionTooLate = errors.New("bids can only be retracted more than 12 hours before the auction ends")
+	ErrRetractionLimit   = errors.New("monthly bid retraction limit reached")
+	ErrBidderIsSeller    = errors.New("sellers cannot bid on their own auction")
+)
 
-func (bs *BidsService) PlaceBid(ctx context.Context, product_id, bidder_id uuid.UUID, bid_amount float64) (pgstore.Bid, error) {
-	// ammount > previus_amount
-	// ammount > baseprice
+// SQLSTATE codes raised by the bids_check_allowed trigger.
+const (
+	pgCodeAuctionClosed  = "GB001"
+	pgCodeBidderIsSeller = "GB002"
+)
+
+// withTx runs fn with a copy of bs whose queries all run in a single
+// transaction, which is committed when fn succeeds. Bids rejected by the
+// database are reported with the matching service errors.
+func (bs *BidsService) withTx(ctx context.Context, fn func(tx *BidsService) error) error {
+	tx, err := bs.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&BidsService{queries: bs.queries.WithTx(tx), pool: bs.pool}); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case pgCodeAuctionClosed:
+				return ErrAuctionEnded
+			case pgCodeBidderIsSeller:
+				return ErrBidderIsSeller
+			}
+		}
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// lockProduct returns product_id, holding a lock on it until the transaction
+// of bs ends so that bids on it are placed one at a time.
+func (bs *BidsService) lockProduct(ctx context.Context, product_id uuid.UUID) (pgstore.Product, error) {
+	product, err := bs.queries.GetProductByIDForUpdate(ctx, product_id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return pgstore.Product{}, ErrProductNotFound
+		}
+		return pgstore.Product{}, err
+	}
+	return product, nil
+}
+
+// GetProduct returns product_id as it stands in the database.
+func (bs *BidsService) GetProduct(ctx context.Context, product_id uuid.UUID) (pgstore.Product, error) {
 	product, err := bs.queries.GetProductByID(ctx, product_id)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return pgstore.Bid{}, err
+			return pgstore.Product{}, ErrProductNotFound
+		}
+		return pgstore.Product{}, err
+	}
+	return product, nil
+}
+
+// isSealedBid reports whether bids on product stay hidden until it closes.
+func isSealedBid(product pgstore.Product) bool {
+	return product.AuctionType == pgstore.AuctionTypeSealedFirstPrice ||
+		product.AuctionType == pgstore.AuctionTypeSealedSecondPrice
+}
+
+// BidTooLowError is returned when a bid or maximum bid is below the minimum
+// acceptable next bid. It matches ErrBidAmountTooLow or ErrMaxBidTooLow.
+type BidTooLowError struct {
+	MinNextBid money.Amount
+	Currency   money.Currency
+	err        error
+}
+
+func (e *BidTooLowError) Error() string {
+	return fmt.Sprintf("%s: must be at least %s", e.err, e.Currency.Format(e.MinNextBid))
+}
+
+func (e *BidTooLowError) Unwrap() error {
+	return e.err
+}
+
+// AuctionExtendedError is returned when settling an auction that a late bid
+// extended in the meantime. It matches ErrAuctionNotOver.
+type AuctionExtendedError struct {
+	AuctionEnd time.Time
+}
+
+func (e *AuctionExtendedError) Error() string {
+	return fmt.Sprintf("%s: extended until %s", ErrAuctionNotOver, e.AuctionEnd.Format(time.RFC3339))
+}
+
+func (e *AuctionExtendedError) Unwrap() error {
+	return ErrAuctionNotOver
+}
+
+// defaultBidIncrements applies to products without a fixed bid increment.
+// The step of the first tier whose limit is above the current price is used,
+// in the units of the product's currency.
+var defaultBidIncrements = []struct {
+	limit money.Amount
+	step  money.Amount
+}{
+	{limit: 1 * money.Unit, step: 5 * money.Cent},
+	{limit: 5 * money.Unit, step: 25 * money.Cent},
+	{limit: 25 * money.Unit, step: 50 * money.Cent},
+	{limit: 100 * money.Unit, step: 1 * money.Unit},
+	{limit: 250 * money.Unit, step: 250 * money.Cent},
+	{limit: 500 * money.Unit, step: 5 * money.Unit},
+	{limit: 1000 * money.Unit, step: 10 * money.Unit},
+	{limit: 2500 * money.Unit, step: 25 * money.Unit},
+	{limit: 5000 * money.Unit, step: 50 * money.Unit},
+	{limit: money.Max, step: 100 * money.Unit},
+}
+
+// bidIncrement returns how much a new bid must add to price, rounded up to
+// the minor unit of the product's currency so that bids on it can always be
+// expressed in it.
+func bidIncrement(product pgstore.Product, price money.Amount) money.Amount {
+	if product.BidIncrement > 0 {
+		return product.Currency.RoundUp(product.BidIncrement)
+	}
+	step := defaultBidIncrements[len(defaultBidIncrements)-1].step
+	for _, tier := range defaultBidIncrements {
+		if price < tier.limit {
+			step = tier.step
+			break
 		}
 	}
+	return product.Currency.RoundUp(step)
+}
+
+// currentPrice is the amount the next bid has to beat.
+func currentPrice(product pgstore.Product, highestBid pgstore.Bid) money.Amount {
+	return max(product.BasePrice, highestBid.BidAmount)
+}
+
+// MinNextBid returns the lowest amount a new bid on product can have.
+func MinNextBid(product pgstore.Product, highestBid pgstore.Bid) money.Amount {
+	price := currentPrice(product, highestBid)
+	return price + bidIncrement(product, price)
+}
+
+// reserveMet reports whether highestBid reaches the product's reserve price.
+// Products without a reserve always meet it.
+func reserveMet(product pgstore.Product, highestBid pgstore.Bid) bool {
+	return product.ReservePrice == nil || highestBid.BidAmount >= *product.ReservePrice
+}
+
+// AuctionState is where an auction stands, for clients catching up with it.
+// Sealed bids are never revealed, and the reserve price itself is never
+// exposed, only whether the leading bid meets it. Amounts are in the
+// currency of the product.
+type AuctionState struct {
+	Product    pgstore.Product
+	HighestBid pgstore.Bid
+	MinNextBid money.Amount
+	ReserveMet bool
+
+	// BidCount counts the bids on the auction, and RecentBids holds the
+	// latest of them, newest first.
+	BidCount   int
+	RecentBids []pgstore.Bid
+}
+
+// recentBids bounds the bids AuctionState returns.
+const recentBids = 10
+
+// AuctionState returns where product_id stands now.
+func (bs *BidsService) AuctionState(ctx context.Context, product_id uuid.UUID) (AuctionState, error) {
+	product, err := bs.queries.GetProductByID(ctx, product_id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return AuctionState{}, ErrProductNotFound
+		}
+		return AuctionState{}, err
+	}
+	switch {
+	case isSealedBid(product):
+		return AuctionState{Product: product, MinNextBid: product.BasePrice}, nil
+	case product.AuctionType == pgstore.AuctionTypeDutch:
+		return AuctionState{Product: product, MinNextBid: DutchPrice(product, time.Now())}, nil
+	}
+
+	// every bid has to beat the previous one, so the highest bids are also
+	// the latest
+	bids, err := bs.queries.GetRecentBidsByProductID(ctx, pgstore.GetRecentBidsByProductIDParams{
+		ProductID: product_id,
+		Limit:     recentBids,
+	})
+	if err != nil {
+		return AuctionState{}, err
+	}
+	count, err := bs.queries.CountBidsByProductID(ctx, product_id)
+	if err != nil {
+		return AuctionState{}, err
+	}
+	var highestBid pgstore.Bid
+	if len(bids) > 0 {
+		highestBid = bids[0]
+	}
+	return AuctionState{
+		Product:    product,
+		HighestBid: highestBid,
+		MinNextBid: MinNextBid(product, highestBid),
+		ReserveMet: reserveMet(product, highestBid),
+		BidCount:   int(count),
+		RecentBids: bids,
+	}, nil
+}
+
+// PlacedBids holds every bid accepted by a single PlaceBid or PlaceMaxBid
+// call, in the order they were placed: the bidder's own bid followed by the
+// automatic bids placed on behalf of proxy bidders. When a bid lands inside
+// the product's soft close window, Extended is set and AuctionEnd holds the
+// new end of the auction. Amounts are in Currency, the currency of the
+// product.
+type PlacedBids struct {
+	Bids       []pgstore.Bid
+	Currency   money.Currency
+	AuctionEnd time.Time
+	Extended   bool
+	HasReserve bool
+	ReserveMet bool
+	Sealed     bool
+}
+
+// PlaceBid bids bid_amount on product_id on behalf of bidder_id. The bid must
+// be in the currency of the product; an empty currency stands for it.
+func (bs *BidsService) PlaceBid(ctx context.Context, product_id, bidder_id uuid.UUID, bid_amount money.Amount, currency money.Currency) (PlacedBids, error) {
+	var placed PlacedBids
+	err := bs.withTx(ctx, func(tx *BidsService) (err error) {
+		placed, err = tx.placeBid(ctx, product_id, bidder_id, bid_amount, currency)
+		return err
+	})
+	return placed, err
+}
+
+func (bs *BidsService) placeBid(ctx context.Context, product_id, bidder_id uuid.UUID, bid_amount money.Amount, currency money.Currency) (PlacedBids, error) {
+	// ammount > previus_amount
+	// ammount > baseprice
+	product, err := bs.lockProduct(ctx, product_id)
+	if err != nil {
+		return PlacedBids{}, err
+	}
+	if err := checkAmount(product, bid_amount, currency); err != nil {
+		return PlacedBids{}, err
+	}
+	if product.IsSold || product.ClosedAt.Valid {
+		return PlacedBids{}, ErrAuctionEnded
+	}
+	if product.SellerID == bidder_id {
+		return PlacedBids{}, ErrBidderIsSeller
+	}
+	if time.Now().Before(product.AuctionStart) {
+		return PlacedBids{}, ErrAuctionNotStarted
+	}
+	if product.AuctionType == pgstore.AuctionTypeDutch {
+		return PlacedBids{}, ErrDutchAuction
+	}
+	if isSealedBid(product) {
+		return bs.placeSealedBid(ctx, product, bidder_id, bid_amount)
+	}
 
 	highestBid, err := bs.queries.GetHighestBidByProductID(ctx, product_id)
 	if err != nil {
 		if !errors.Is(err, pgx.ErrNoRows) {
-			return pgstore.Bid{}, err
+			return PlacedBids{}, err
 		}
 	}
 
-	if product.BasePrice >= bid_amount || highestBid.BidAmount >= bid_amount {
-		return pgstore.Bid{}, ErrBidAmountTooLow
+	if minNextBid := MinNextBid(product, highestBid); bid_amount < minNextBid {
+		return PlacedBids{}, &BidTooLowError{MinNextBid: minNextBid, Currency: product.Currency, err: ErrBidAmountTooLow}
 	}
 	highestBid, err = bs.queries.CreateBid(ctx, pgstore.CreateBidParams{
 		ProductID: product_id,
-		BidderID: bidder_id,
+		BidderID:  bidder_id,
 		BidAmount: bid_amount,
 	})
 	if err != nil {
-		return pgstore.Bid{}, err
+		return PlacedBids{}, err
+	}
+
+	placed := PlacedBids{
+		Bids:       []pgstore.Bid{highestBid},
+		Currency:   product.Currency,
+		AuctionEnd: product.AuctionEnd,
+	}
+	if err := bs.resolveProxyBids(ctx, product, highestBid, &placed); err != nil {
+		return PlacedBids{}, err
+	}
+	return bs.applySoftClose(ctx, product, placed)
+}
+
+// PlaceMaxBid registers max_amount as the private maximum of bidder_id and
+// bids on their behalf, up to that maximum, whenever they are outbid. Like
+// bids, the maximum must be in the currency of the product.
+func (bs *BidsService) PlaceMaxBid(ctx context.Context, product_id, bidder_id uuid.UUID, max_amount money.Amount, currency money.Currency) (PlacedBids, error) {
+	var placed PlacedBids
+	err := bs.withTx(ctx, func(tx *BidsService) (err error) {
+		placed, err = tx.placeMaxBid(ctx, product_id, bidder_id, max_amount, currency)
+		return err
+	})
+	return placed, err
+}
+
+func (bs *BidsService) placeMaxBid(ctx context.Context, product_id, bidder_id uuid.UUID, max_amount money.Amount, currency money.Currency) (PlacedBids, error) {
+	product, err := bs.lockProduct(ctx, product_id)
+	if err != nil {
+		return PlacedBids{}, err
+	}
+	if err := checkAmount(product, max_amount, currency); err != nil {
+		return PlacedBids{}, err
+	}
+	if product.IsSold || product.ClosedAt.Valid {
+		return PlacedBids{}, ErrAuctionEnded
+	}
+	if product.SellerID == bidder_id {
+		return PlacedBids{}, ErrBidderIsSeller
+	}
+	if time.Now().Before(product.AuctionStart) {
+		return PlacedBids{}, ErrAuctionNotStarted
+	}
+	if product.AuctionType != pgstore.AuctionTypeEnglish {
+		return PlacedBids{}, ErrMaxBidUnavailable
+	}
+
+	highestBid, err := bs.queries.GetHighestBidByProductID(ctx, product_id)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return PlacedBids{}, err
+		}
+	}
+
+	if minNextBid := MinNextBid(product, highestBid); max_amount < minNextBid {
+		return PlacedBids{}, &BidTooLowError{MinNextBid: minNextBid, Currency: product.Currency, err: ErrMaxBidTooLow}
+	}
+	_, err = bs.queries.UpsertProxyBid(ctx, pgstore.UpsertProxyBidParams{
+		ProductID: product_id,
+		BidderID:  bidder_id,
+		MaxAmount: max_amount,
+	})
+	if err != nil {
+		return PlacedBids{}, err
+	}
+
+	placed := PlacedBids{Currency: product.Currency, AuctionEnd: product.AuctionEnd}
+	if err := bs.resolveProxyBids(ctx, product, highestBid, &placed); err != nil {
+		return PlacedBids{}, err
+	}
+	return bs.applySoftClose(ctx, product, placed)
+}
+
+// checkAmount makes sure amount, given in currency, is denominated in the
+// currency of product and does not go below its minor unit.
+func checkAmount(product pgstore.Product, amount money.Amount, currency money.Currency) error {
+	if currency != "" && currency != product.Currency {
+		return money.ErrCurrencyMismatch
+	}
+	if !product.Currency.Allows(amount) {
+		return money.ErrTooPrecise
+	}
+	return nil
+}
+
+// placeSealedBid records the single hidden bid of bidder_id on a sealed-bid
+// auction. Bidding again revises the previous bid instead of adding one.
+func (bs *BidsService) placeSealedBid(ctx context.Context, product pgstore.Product, bidder_id uuid.UUID, bid_amount money.Amount) (PlacedBids, error) {
+	if bid_amount < product.BasePrice {
+		return PlacedBids{}, &BidTooLowError{MinNextBid: product.BasePrice, Currency: product.Currency, err: ErrBidAmountTooLow}
+	}
+
+	bid, err := bs.queries.GetBidByProductAndBidder(ctx, pgstore.GetBidByProductAndBidderParams{
+		ProductID: product.ID,
+		BidderID:  bidder_id,
+	})
+	switch {
+	case err == nil:
+		bid, err = bs.queries.UpdateBidAmount(ctx, pgstore.UpdateBidAmountParams{
+			ID:        bid.ID,
+			BidAmount: bid_amount,
+		})
+	case errors.Is(err, pgx.ErrNoRows):
+		bid, err = bs.queries.CreateBid(ctx, pgstore.CreateBidParams{
+			ProductID: product.ID,
+			BidderID:  bidder_id,
+			BidAmount: bid_amount,
+		})
+	}
+	if err != nil {
+		return PlacedBids{}, err
+	}
+	return PlacedBids{
+		Bids:       []pgstore.Bid{bid},
+		Currency:   product.Currency,
+		AuctionEnd: product.AuctionEnd,
+		Sealed:     true,
+	}, nil
+}
+
+// resolveProxyBids bids on behalf of proxy bidders until the highest bid is
+// held by the bidder with the greatest maximum. Every automatic bid is the
+// smallest amount that keeps its bidder in the lead, so maximums are never
+// revealed. A zero highestBid means the product has no bids yet.
+func (bs *BidsService) resolveProxyBids(ctx context.Context, product pgstore.Product, highestBid pgstore.Bid, placed *PlacedBids) error {
+	proxies, err := bs.queries.GetProxyBidsByProductID(ctx, product.ID)
+	if err != nil {
+		return err
+	}
+
+	price, leaderID := currentPrice(product, highestBid), highestBid.BidderID
+	for {
+		increment := bidIncrement(product, price)
+		// proxies are sorted by max_amount, so the first one that is not the
+		// leader's is the strongest challenger.
+		var challenger, defender *pgstore.ProxyBid
+		for i := range proxies {
+			if proxies[i].BidderID == leaderID {
+				defender = &proxies[i]
+				continue
+			}
+			if challenger == nil && proxies[i].MaxAmount >= price+increment {
+				challenger = &proxies[i]
+			}
+		}
+		if challenger == nil {
+			return nil
+		}
+
+		defense := price
+		if defender != nil {
+			defense = max(price, defender.MaxAmount)
+		}
+		bidderID, bidAmount := challenger.BidderID, min(challenger.MaxAmount, defense+bidIncrement(product, defense))
+		if defender != nil && defender.MaxAmount >= challenger.MaxAmount {
+			// ties go to the current leader
+			bidderID, bidAmount = leaderID, min(defender.MaxAmount, challenger.MaxAmount+bidIncrement(product, challenger.MaxAmount))
+		}
+
+		bid, err := bs.queries.CreateBid(ctx, pgstore.CreateBidParams{
+			ProductID: product.ID,
+			BidderID:  bidderID,
+			BidAmount: bidAmount,
+		})
+		if err != nil {
+			return err
+		}
+		placed.Bids = append(placed.Bids, bid)
+		price, leaderID = bidAmount, bidderID
+	}
+}
+
+// applySoftClose extends the auction when the last placed bid arrived inside
+// the product's soft close window, and reports the reserve status after it.
+func (bs *BidsService) applySoftClose(ctx context.Context, product pgstore.Product, placed PlacedBids) (PlacedBids, error) {
+	if len(placed.Bids) == 0 {
+		return placed, nil
+	}
+
+	lastBid := placed.Bids[len(placed.Bids)-1]
+	placed.HasReserve = product.ReservePrice != nil
+	placed.ReserveMet = reserveMet(product, lastBid)
+	window := time.Duration(product.SoftCloseWindowSeconds) * time.Second
+	if window == 0 || time.Until(product.AuctionEnd) >= window {
+		return placed, nil
+	}
+
+	extension := time.Duration(product.SoftCloseExtensionSeconds) * time.Second
+	auctionEnd, err := bs.queries.ExtendAuction(ctx, pgstore.ExtendAuctionParams{
+		ID:         product.ID,
+		AuctionEnd: lastBid.CreatedAt.Add(extension),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return placed, nil
+		}
+		return PlacedBids{}, err
+	}
+	placed.AuctionEnd = auctionEnd
+	placed.Extended = true
+	return placed, nil
+}
+
+const (
+	retractionCutoff       = 12 * time.Hour
+	maxRetractionsPerMonth = 3
+)
+
+// RetractedBid describes the state of an auction after one of its bids was
+// retracted or voided. LeadingBid is zero when no bids are left.
+type RetractedBid struct {
+	Bid        pgstore.Bid
+	LeadingBid pgstore.Bid
+	MinNextBid money.Amount
+	Currency   money.Currency
+	HasReserve bool
+	ReserveMet bool
+	Sealed     bool
+}
+
+// RetractBid withdraws bid_id of product_id on behalf of its bidder. Bids can only be
+// retracted while the auction is open and more than retractionCutoff before
+// it ends, and a bidder can retract at most maxRetractionsPerMonth bids in a
+// month.
+func (bs *BidsService) RetractBid(ctx context.Context, product_id, bid_id, bidder_id uuid.UUID, reason string) (RetractedBid, error) {
+	var retracted RetractedBid
+	err := bs.withTx(ctx, func(tx *BidsService) (err error) {
+		retracted, err = tx.retractOwnBid(ctx, product_id, bid_id, bidder_id, reason)
+		return err
+	})
+	return retracted, err
+}
+
+func (bs *BidsService) retractOwnBid(ctx context.Context, product_id, bid_id, bidder_id uuid.UUID, reason string) (RetractedBid, error) {
+	bid, product, err := bs.openBid(ctx, bid_id)
+	if err != nil {
+		return RetractedBid{}, err
+	}
+	if bid.ProductID != product_id {
+		return RetractedBid{}, ErrBidNotFound
+	}
+	if bid.BidderID != bidder_id {
+		return RetractedBid{}, ErrNotBidder
+	}
+	if time.Until(product.AuctionEnd) <= retractionCutoff {
+		return RetractedBid{}, ErrRetractionTooLate
+	}
+
+	retractions, err := bs.queries.CountRetractionsByBidderSince(ctx, pgstore.CountRetractionsByBidderSinceParams{
+		BidderID:    bidder_id,
+		RetractedAt: pgtype.Timestamptz{Time: time.Now().AddDate(0, -1, 0), Valid: true},
+	})
+	if err != nil {
+		return RetractedBid{}, err
+	}
+	if retractions >= maxRetractionsPerMonth {
+		return RetractedBid{}, ErrRetractionLimit
+	}
+	return bs.retractBid(ctx, product, bid, reason, nil)
+}
+
+// VoidBid withdraws bid_id on behalf of the admin admin_id. Voided bids do
+// not count towards the retraction limit of their bidder.
+func (bs *BidsService) VoidBid(ctx context.Context, bid_id, admin_id uuid.UUID, reason string) (RetractedBid, error) {
+	var retracted RetractedBid
+	err := bs.withTx(ctx, func(tx *BidsService) error {
+		bid, product, err := tx.openBid(ctx, bid_id)
+		if err != nil {
+			return err
+		}
+		retracted, err = tx.retractBid(ctx, product, bid, reason, &admin_id)
+		return err
+	})
+	return retracted, err
+}
+
+// openBid returns bid_id, which must not be retracted yet, along with its
+// product, which must still be open for bidding.
+func (bs *BidsService) openBid(ctx context.Context, bid_id uuid.UUID) (pgstore.Bid, pgstore.Product, error) {
+	bid, err := bs.queries.GetBidByID(ctx, bid_id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return pgstore.Bid{}, pgstore.Product{}, ErrBidNotFound
+		}
+		return pgstore.Bid{}, pgstore.Product{}, err
+	}
+	if bid.RetractedAt.Valid {
+		return pgstore.Bid{}, pgstore.Product{}, ErrBidNotFound
+	}
+
+	product, err := bs.lockProduct(ctx, bid.ProductID)
+	if err != nil {
+		return pgstore.Bid{}, pgstore.Product{}, err
+	}
+	if product.IsSold || product.ClosedAt.Valid || time.Now().After(product.AuctionEnd) {
+		return pgstore.Bid{}, pgstore.Product{}, ErrAuctionEnded
+	}
+	return bid, product, nil
+}
+
+// retractBid soft deletes bid, removes the maximum bid of its bidder so no
+// new bids are placed on their behalf, and works out the new leading bid.
+func (bs *BidsService) retractBid(ctx context.Context, product pgstore.Product, bid pgstore.Bid, reason string, voided_by *uuid.UUID) (RetractedBid, error) {
+	bid, err := bs.queries.RetractBid(ctx, pgstore.RetractBidParams{
+		ID:               bid.ID,
+		RetractionReason: reason,
+		VoidedBy:         voided_by,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return RetractedBid{}, ErrBidNotFound
+		}
+		return RetractedBid{}, err
+	}
+	err = bs.queries.DeleteProxyBid(ctx, pgstore.DeleteProxyBidParams{
+		ProductID: product.ID,
+		BidderID:  bid.BidderID,
+	})
+	if err != nil {
+		return RetractedBid{}, err
+	}
+
+	leadingBid, err := bs.queries.GetHighestBidByProductID(ctx, product.ID)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return RetractedBid{}, err
+		}
+	}
+	return RetractedBid{
+		Bid:        bid,
+		LeadingBid: leadingBid,
+		MinNextBid: MinNextBid(product, leadingBid),
+		Currency:   product.Currency,
+		HasReserve: product.ReservePrice != nil,
+		ReserveMet: reserveMet(product, leadingBid),
+		Sealed:     isSealedBid(product),
+	}, nil
+}
+
+type AuctionResult struct {
+	Sold           bool
+	WinnerID       uuid.UUID
+	FinalPrice     money.Amount
+	Currency       money.Currency
+	ReserveNotMet  bool
+	BoughtOutright bool
+	EndedEarly     bool
+
+	// Reason is the seller's explanation for ending the auction early.
+	Reason string
+
+	// Ranking lists every bid of a sealed-bid auction, highest first.
+	Ranking []RankedBid
+}
+
+type RankedBid struct {
+	Rank      int          `json:"rank"`
+	BidderID  uuid.UUID    `json:"bidder_id"`
+	BidAmount money.Amount `json:"bid_amount"`
+}
+
+// DutchPrice returns the price of a Dutch auction at t. The price starts at
+// the base price when the auction starts and drops by the product's price
+// step on every interval, down to the reserve price, or to a single step when
+// there is no reserve. It never rises above the base price nor falls below
+// zero.
+func DutchPrice(product pgstore.Product, t time.Time) money.Amount {
+	floor := product.DutchPriceStep
+	if product.ReservePrice != nil {
+		floor = *product.ReservePrice
+	}
+	floor = min(max(floor, 0), product.BasePrice)
+	interval := time.Duration(product.DutchStepIntervalSeconds) * time.Second
+	elapsed := t.Sub(product.AuctionStart)
+	if elapsed <= 0 || interval <= 0 {
+		return product.BasePrice
+	}
+	steps := money.Amount(elapsed / interval)
+	return max(floor, product.BasePrice-steps*product.DutchPriceStep)
+}
+
+// NextDutchPriceDrop returns when the price of a Dutch auction drops next
+// after t.
+func NextDutchPriceDrop(product pgstore.Product, t time.Time) time.Time {
+	interval := time.Duration(product.DutchStepIntervalSeconds) * time.Second
+	elapsed := t.Sub(product.AuctionStart)
+	if elapsed < 0 {
+		return product.AuctionStart.Add(interval)
+	}
+	return product.AuctionStart.Add((elapsed/interval + 1) * interval)
+}
+
+// AcceptDutchPrice sells a Dutch auction to buyer_id at its current price.
+func (bs *BidsService) AcceptDutchPrice(ctx context.Context, product_id, buyer_id uuid.UUID) (AuctionResult, error) {
+	var result AuctionResult
+	err := bs.withTx(ctx, func(tx *BidsService) (err error) {
+		result, err = tx.acceptDutchPrice(ctx, product_id, buyer_id)
+		return err
+	})
+	return result, err
+}
+
+func (bs *BidsService) acceptDutchPrice(ctx context.Context, product_id, buyer_id uuid.UUID) (AuctionResult, error) {
+	product, err := bs.lockProduct(ctx, product_id)
+	if err != nil {
+		return AuctionResult{}, err
+	}
+	if product.AuctionType != pgstore.AuctionTypeDutch {
+		return AuctionResult{}, ErrNotDutchAuction
+	}
+	if product.IsSold || product.ClosedAt.Valid || time.Now().After(product.AuctionEnd) {
+		return AuctionResult{}, ErrAuctionEnded
+	}
+	if time.Now().Before(product.AuctionStart) {
+		return AuctionResult{}, ErrAuctionNotStarted
+	}
+	if product.SellerID == buyer_id {
+		return AuctionResult{}, ErrBidderIsSeller
+	}
+
+	price := DutchPrice(product, time.Now())
+	bid, err := bs.queries.CreateBid(ctx, pgstore.CreateBidParams{
+		ProductID: product_id,
+		BidderID:  buyer_id,
+		BidAmount: price,
+	})
+	if err != nil {
+		return AuctionResult{}, err
+	}
+	return bs.markSold(ctx, product, bid.BidderID, bid.BidAmount, pgstore.CloseKindPriceAccepted, "")
+}
+
+// BuyNow sells product_id to buyer_id at its buy now price, closing the
+// auction. It is only possible once the auction has started and while the
+// product has no bids.
+func (bs *BidsService) BuyNow(ctx context.Context, product_id, buyer_id uuid.UUID) (AuctionResult, error) {
+	var result AuctionResult
+	err := bs.withTx(ctx, func(tx *BidsService) (err error) {
+		result, err = tx.buyNow(ctx, product_id, buyer_id)
+		return err
+	})
+	return result, err
+}
+
+func (bs *BidsService) buyNow(ctx context.Context, product_id, buyer_id uuid.UUID) (AuctionResult, error) {
+	// bids are only placed with the product locked, so none can be placed
+	// between the check below and the sale
+	if _, err := bs.lockProduct(ctx, product_id); err != nil {
+		return AuctionResult{}, err
+	}
+	_, err := bs.queries.GetHighestBidByProductID(ctx, product_id)
+	if err == nil {
+		return AuctionResult{}, ErrBuyNowUnavailable
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return AuctionResult{}, err
+	}
+
+	sale, err := bs.queries.BuyNow(ctx, pgstore.BuyNowParams{
+		ID:      product_id,
+		BuyerID: buyer_id,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return AuctionResult{}, ErrBuyNowUnavailable
+		}
+		return AuctionResult{}, err
+	}
+	return AuctionResult{
+		Sold:           true,
+		WinnerID:       buyer_id,
+		FinalPrice:     *sale.BuyNowPrice,
+		Currency:       sale.Currency,
+		BoughtOutright: true,
+	}, nil
+}
+
+// sellerAuction returns product_id if seller_id may close it.
+func (bs *BidsService) sellerAuction(ctx context.Context, product_id, seller_id uuid.UUID) (pgstore.Product, error) {
+	product, err := bs.lockProduct(ctx, product_id)
+	if err != nil {
+		return pgstore.Product{}, err
+	}
+	if product.SellerID != seller_id {
+		return pgstore.Product{}, ErrNotSeller
+	}
+	if product.ClosedAt.Valid {
+		return pgstore.Product{}, ErrAuctionEnded
+	}
+	return product, nil
+}
+
+// CancelAuction lets the seller of product_id pull the listing. The product
+// is left unsold and reason is recorded as the cause.
+func (bs *BidsService) CancelAuction(ctx context.Context, product_id, seller_id uuid.UUID, reason string) error {
+	return bs.withTx(ctx, func(tx *BidsService) error {
+		return tx.cancelAuction(ctx, product_id, seller_id, reason)
+	})
+}
+
+func (bs *BidsService) cancelAuction(ctx context.Context, product_id, seller_id uuid.UUID, reason string) error {
+	if _, err := bs.sellerAuction(ctx, product_id, seller_id); err != nil {
+		return err
+	}
+	rows, err := bs.queries.CancelAuction(ctx, pgstore.CancelAuctionParams{
+		ID:          product_id,
+		CloseReason: reason,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrAuctionEnded
+	}
+	return nil
+}
+
+// EndAuctionEarly lets the seller of product_id close the auction right away,
+// selling the product to the current highest bidder even when the reserve
+// price was not met.
+func (bs *BidsService) EndAuctionEarly(ctx context.Context, product_id, seller_id uuid.UUID, reason string) (AuctionResult, error) {
+	var result AuctionResult
+	err := bs.withTx(ctx, func(tx *BidsService) (err error) {
+		result, err = tx.endAuctionEarly(ctx, product_id, seller_id, reason)
+		return err
+	})
+	return result, err
+}
+
+func (bs *BidsService) endAuctionEarly(ctx context.Context, product_id, seller_id uuid.UUID, reason string) (AuctionResult, error) {
+	product, err := bs.sellerAuction(ctx, product_id, seller_id)
+	if err != nil {
+		return AuctionResult{}, err
+	}
+
+	bids, err := bs.queries.GetBidsByProductID(ctx, product_id)
+	if err != nil {
+		return AuctionResult{}, err
+	}
+	if len(bids) == 0 {
+		return AuctionResult{}, ErrNoBids
+	}
+
+	result, err := bs.markSold(ctx, product, bids[0].BidderID, winningPrice(product, bids), pgstore.CloseKindEndedEarly, reason)
+	result.EndedEarly = true
+	result.Reason = reason
+	if isSealedBid(product) {
+		result.Ranking = rankBids(bids)
+	}
+	return result, err
+}
+
+// SettleAuction closes the auction for product_id, selling it to the highest
+// bidder. Auctions without bids, or whose highest bid does not reach the
+// reserve price, are marked as unsold.
+func (bs *BidsService) SettleAuction(ctx context.Context, product_id uuid.UUID) (AuctionResult, error) {
+	var result AuctionResult
+	err := bs.withTx(ctx, func(tx *BidsService) (err error) {
+		result, err = tx.settleAuction(ctx, product_id)
+		return err
+	})
+	return result, err
+}
+
+func (bs *BidsService) settleAuction(ctx context.Context, product_id uuid.UUID) (AuctionResult, error) {
+	product, err := bs.lockProduct(ctx, product_id)
+	if err != nil {
+		return AuctionResult{}, err
+	}
+	// a late bid may have pushed the end back while the lock was awaited
+	if product.AuctionEnd.After(time.Now()) {
+		return AuctionResult{}, &AuctionExtendedError{AuctionEnd: product.AuctionEnd}
+	}
+	if isSealedBid(product) {
+		return bs.settleSealedBidAuction(ctx, product)
+	}
+
+	highestBid, err := bs.queries.GetHighestBidByProductID(ctx, product_id)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return AuctionResult{}, err
+		}
+		return AuctionResult{}, bs.markUnsold(ctx, product_id, pgstore.CloseKindNoBids)
+	}
+
+	if !reserveMet(product, highestBid) {
+		return AuctionResult{ReserveNotMet: true}, bs.markUnsold(ctx, product_id, pgstore.CloseKindReserveNotMet)
+	}
+	return bs.markSold(ctx, product, highestBid.BidderID, highestBid.BidAmount, pgstore.CloseKindSold, "")
+}
+
+func rankBids(bids []pgstore.Bid) []RankedBid {
+	ranking := make([]RankedBid, len(bids))
+	for i, bid := range bids {
+		ranking[i] = RankedBid{
+			Rank:      i + 1,
+			BidderID:  bid.BidderID,
+			BidAmount: bid.BidAmount,
+		}
+	}
+	return ranking
+}
+
+// settleSealedBidAuction reveals the bids of a sealed-bid auction. The
+// highest bidder wins and pays their own bid on first-price auctions, or the
+// second highest bid (never less than the base and reserve prices) on
+// second-price auctions.
+func (bs *BidsService) settleSealedBidAuction(ctx context.Context, product pgstore.Product) (AuctionResult, error) {
+	bids, err := bs.queries.GetBidsByProductID(ctx, product.ID)
+	if err != nil {
+		return AuctionResult{}, err
+	}
+	if len(bids) == 0 {
+		return AuctionResult{}, bs.markUnsold(ctx, product.ID, pgstore.CloseKindNoBids)
+	}
+
+	ranking := rankBids(bids)
+	winner := bids[0]
+	if !reserveMet(product, winner) {
+		return AuctionResult{ReserveNotMet: true, Currency: product.Currency, Ranking: ranking}, bs.markUnsold(ctx, product.ID, pgstore.CloseKindReserveNotMet)
+	}
+
+	result, err := bs.markSold(ctx, product, winner.BidderID, winningPrice(product, bids), pgstore.CloseKindSold, "")
+	result.Ranking = ranking
+	return result, err
+}
+
+// winningPrice is what the highest of bids pays for product: their own bid,
+// or on second-price auctions the second highest bid, never less than the
+// base and reserve prices nor more than their own bid. bids are sorted from
+// the highest.
+func winningPrice(product pgstore.Product, bids []pgstore.Bid) money.Amount {
+	if product.AuctionType != pgstore.AuctionTypeSealedSecondPrice {
+		return bids[0].BidAmount
+	}
+	price := product.BasePrice
+	if len(bids) > 1 {
+		price = max(price, bids[1].BidAmount)
+	}
+	if product.ReservePrice != nil {
+		price = max(price, *product.ReservePrice)
+	}
+	// sellers ending an auction early may sell below the reserve
+	return min(price, bids[0].BidAmount)
+}
+
+// markUnsold closes product_id without a winner, as kind. It fails with
+// ErrAuctionEnded when the auction was already closed.
+func (bs *BidsService) markUnsold(ctx context.Context, product_id uuid.UUID, kind pgstore.CloseKind) error {
+	rows, err := bs.queries.SettleAuction(ctx, pgstore.SettleAuctionParams{
+		ID:        product_id,
+		IsSold:    false,
+		CloseKind: pgstore.NullCloseKind{CloseKind: kind, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrAuctionEnded
+	}
+	return nil
+}
+
+// markSold closes product as kind, selling it to winner_id for price. reason
+// is the explanation of the seller, if any. It fails with ErrAuctionEnded
+// when the auction was already closed.
+func (bs *BidsService) markSold(ctx context.Context, product pgstore.Product, winner_id uuid.UUID, price money.Amount, kind pgstore.CloseKind, reason string) (AuctionResult, error) {
+	rows, err := bs.queries.SettleAuction(ctx, pgstore.SettleAuctionParams{
+		ID:          product.ID,
+		IsSold:      true,
+		WinnerID:    &winner_id,
+		FinalPrice:  &price,
+		CloseKind:   pgstore.NullCloseKind{CloseKind: kind, Valid: true},
+		CloseReason: reason,
+	})
+	if err != nil {
+		return AuctionResult{}, err
+	}
+	if rows == 0 {
+		return AuctionResult{}, ErrAuctionEnded
 	}
-	return highestBid, nil
+	return AuctionResult{
+		Sold:       true,
+		WinnerID:   winner_id,
+		FinalPrice: price,
+		Currency:   product.Currency,
+	}, nil
 }
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LucasLCabral/go-bid/internal/money"
+	"github.com/LucasLCabral/go-bid/internal/store/pgstore"
+)
+
+func amount(a money.Amount) *money.Amount {
+	return &a
+}
+
+func TestMinNextBid(t *testing.T) {
+	tests := []struct {
+		name       string
+		product    pgstore.Product
+		highestBid money.Amount
+		want       money.Amount
+	}{
+		{
+			name:    "no bids",
+			product: pgstore.Product{BasePrice: 10 * money.Unit, Currency: "USD"},
+			want:    10*money.Unit + 50*money.Cent,
+		},
+		{
+			name:       "above the base price",
+			product:    pgstore.Product{BasePrice: 10 * money.Unit, Currency: "USD"},
+			highestBid: 150 * money.Unit,
+			want:       152*money.Unit + 50*money.Cent,
+		},
+		{
+			name:    "cheapest tier",
+			product: pgstore.Product{BasePrice: 50 * money.Cent, Currency: "USD"},
+			want:    55 * money.Cent,
+		},
+		{
+			name:       "top tier",
+			product:    pgstore.Product{BasePrice: 10 * money.Unit, Currency: "USD"},
+			highestBid: 10000 * money.Unit,
+			want:       10100 * money.Unit,
+		},
+		{
+			name:    "step rounded to the yen",
+			product: pgstore.Product{BasePrice: 100 * money.Unit, Currency: "JPY"},
+			want:    103 * money.Unit,
+		},
+		{
+			name:       "fixed increment",
+			product:    pgstore.Product{BasePrice: 10 * money.Unit, BidIncrement: 2 * money.Unit, Currency: "USD"},
+			highestBid: 150 * money.Unit,
+			want:       152 * money.Unit,
+		},
+		{
+			name:    "fixed increment rounded to the yen",
+			product: pgstore.Product{BasePrice: 100 * money.Unit, BidIncrement: 150 * money.Cent, Currency: "JPY"},
+			want:    102 * money.Unit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MinNextBid(tt.product, pgstore.Bid{BidAmount: tt.highestBid})
+			if got != tt.want {
+				t.Errorf("MinNextBid = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDutchPrice(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	product := pgstore.Product{
+		BasePrice:                100 * money.Unit,
+		DutchPriceStep:           10 * money.Unit,
+		DutchStepIntervalSeconds: 60,
+		AuctionStart:             start,
+	}
+	withReserve := product
+	withReserve.ReservePrice = amount(75 * money.Unit)
+	negativeReserve := product
+	negativeReserve.ReservePrice = amount(-5 * money.Unit)
+	largeStep := product
+	largeStep.DutchPriceStep = 200 * money.Unit
+
+	tests := []struct {
+		name    string
+		product pgstore.Product
+		at      time.Duration
+		want    money.Amount
+	}{
+		{name: "before start", product: product, at: -time.Minute, want: 100 * money.Unit},
+		{name: "at start", product: product, at: 0, want: 100 * money.Unit},
+		{name: "within the first interval", product: product, at: 59 * time.Second, want: 100 * money.Unit},
+		{name: "after one interval", product: product, at: time.Minute, want: 90 * money.Unit},
+		{name: "after three intervals", product: product, at: 3*time.Minute + 30*time.Second, want: 70 * money.Unit},
+		{name: "down to a single step", product: product, at: time.Hour, want: 10 * money.Unit},
+		{name: "down to the reserve", product: withReserve, at: 3 * time.Minute, want: 75 * money.Unit},
+		{name: "never below zero", product: negativeReserve, at: time.Hour, want: 0},
+		{name: "never above the base price", product: largeStep, at: time.Minute, want: 100 * money.Unit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DutchPrice(tt.product, start.Add(tt.at)); got != tt.want {
+				t.Errorf("DutchPrice = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextDutchPriceDrop(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	product := pgstore.Product{DutchStepIntervalSeconds: 60, AuctionStart: start}
+	tests := []struct {
+		at   time.Duration
+		want time.Duration
+	}{
+		{at: -time.Hour, want: time.Minute},
+		{at: 0, want: time.Minute},
+		{at: 59 * time.Second, want: time.Minute},
+		{at: time.Minute, want: 2 * time.Minute},
+		{at: 150 * time.Second, want: 3 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := NextDutchPriceDrop(product, start.Add(tt.at)); !got.Equal(start.Add(tt.want)) {
+			t.Errorf("NextDutchPriceDrop(start%+v) = start%+v, want start%+v", tt.at, got.Sub(start), tt.want)
+		}
+	}
+}
+
+func TestWinningPrice(t *testing.T) {
+	bids := func(amounts ...money.Amount) []pgstore.Bid {
+		bids := make([]pgstore.Bid, len(amounts))
+		for i, a := range amounts {
+			bids[i] = pgstore.Bid{BidAmount: a}
+		}
+		return bids
+	}
+	firstPrice := pgstore.Product{BasePrice: 10 * money.Unit, AuctionType: pgstore.AuctionTypeSealedFirstPrice}
+	secondPrice := pgstore.Product{BasePrice: 10 * money.Unit, AuctionType: pgstore.AuctionTypeSealedSecondPrice}
+	withReserve := secondPrice
+	withReserve.ReservePrice = amount(40 * money.Unit)
+
+	tests := []struct {
+		name    string
+		product pgstore.Product
+		bids    []pgstore.Bid
+		want    money.Amount
+	}{
+		{name: "first price", product: firstPrice, bids: bids(50*money.Unit, 30*money.Unit), want: 50 * money.Unit},
+		{name: "second price", product: secondPrice, bids: bids(50*money.Unit, 30*money.Unit), want: 30 * money.Unit},
+		{name: "single bid", product: secondPrice, bids: bids(50 * money.Unit), want: 10 * money.Unit},
+		{name: "up to the reserve", product: withReserve, bids: bids(50*money.Unit, 30*money.Unit), want: 40 * money.Unit},
+		{name: "ended early below the reserve", product: withReserve, bids: bids(35*money.Unit, 30*money.Unit), want: 35 * money.Unit},
+		{name: "english", product: pgstore.Product{AuctionType: pgstore.AuctionTypeEnglish}, bids: bids(50*money.Unit, 30*money.Unit), want: 50 * money.Unit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := winningPrice(tt.product, tt.bids); got != tt.want {
+				t.Errorf("winningPrice = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
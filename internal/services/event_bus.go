@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// EventBus carries the events of auction rooms. Rooms publish everything
+// they have to tell their clients on it and only deliver what they consume
+// from it, so anything else subscribed to an auction, such as a notifier or
+// a recording fake in tests, sees the same events.
+type EventBus interface {
+	// Publish hands event to every subscriber of auctionID.
+	Publish(ctx context.Context, auctionID uuid.UUID, event RoomEvent) error
+
+	// Subscribe returns the events published for auctionID from now on,
+	// until unsubscribe is called.
+	Subscribe(auctionID uuid.UUID) (events <-chan RoomEvent, unsubscribe func())
+
+	// IsLeader reports whether this instance accepts the bids of auctionID
+	// and settles it.
+	IsLeader(auctionID uuid.UUID) bool
+}
+
+// LobbyID is the auction ID under which events about the auctions
+// themselves, such as AuctionCreated, are published.
+var LobbyID = uuid.Nil
+
+// RoomEvent is a message of an auction room on its way to the clients of
+// every instance.
+type RoomEvent struct {
+	// Origin is the instance that published the event.
+	Origin uuid.UUID `json:"origin,omitempty"`
+
+	// AuctionID names the auction of lobby events.
+	AuctionID uuid.UUID `json:"auction_id,omitempty"`
+
+	Message Message `json:"message"`
+
+	// To restricts the event to the clients of a single user, and Except
+	// leaves the clients of a single user out.
+	To     *uuid.UUID `json:"to,omitempty"`
+	Except *uuid.UUID `json:"except,omitempty"`
+
+	// Request marks a client request forwarded to the leader.
+	Request bool `json:"request,omitempty"`
+
+	// Close stops the room once the message has been delivered.
+	Close bool `json:"close,omitempty"`
+}
+
+// roomEventJSON is a RoomEvent on its way between instances, along with the
+// payload its message was built from.
+type roomEventJSON struct {
+	plainRoomEvent
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type plainRoomEvent RoomEvent
+
+func (e RoomEvent) MarshalJSON() ([]byte, error) {
+	encoded := roomEventJSON{plainRoomEvent: plainRoomEvent(e)}
+	if e.Message.payload != nil {
+		payload, err := json.Marshal(e.Message.payload)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Payload = payload
+	}
+	return json.Marshal(encoded)
+}
+
+func (e *RoomEvent) UnmarshalJSON(data []byte) error {
+	var decoded roomEventJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*e = RoomEvent(decoded.plainRoomEvent)
+	if len(decoded.Payload) == 0 {
+		return nil
+	}
+	decode, ok := payloadDecoders[e.Message.Kind]
+	if !ok {
+		return fmt.Errorf("message kind %d has no payload", e.Message.Kind)
+	}
+	payload, err := decode(decoded.Payload)
+	if err != nil {
+		return err
+	}
+	e.Message.payload = payload
+	return nil
+}
+
+// isFor reports whether the clients of userID get event.
+func (e RoomEvent) isFor(userID uuid.UUID) bool {
+	return (e.To == nil || *e.To == userID) && (e.Except == nil || *e.Except != userID)
+}
+
+// MemoryEventBus delivers events to the subscribers of a single instance,
+// which is always the leader.
+type MemoryEventBus struct {
+	mu            sync.Mutex
+	subscriptions map[uuid.UUID]map[*subscription]struct{}
+}
+
+func NewMemoryEventBus() *MemoryEventBus {
+	return &MemoryEventBus{
+		subscriptions: make(map[uuid.UUID]map[*subscription]struct{}),
+	}
+}
+
+func (b *MemoryEventBus) Publish(ctx context.Context, auctionID uuid.UUID, event RoomEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscriptions[auctionID] {
+		sub.push(event)
+	}
+	return nil
+}
+
+func (b *MemoryEventBus) Subscribe(auctionID uuid.UUID) (<-chan RoomEvent, func()) {
+	sub := &subscription{
+		events: make(chan RoomEvent),
+		ready:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go sub.pump()
+
+	b.mu.Lock()
+	if b.subscriptions[auctionID] == nil {
+		b.subscriptions[auctionID] = make(map[*subscription]struct{})
+	}
+	b.subscriptions[auctionID][sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.events, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscriptions[auctionID], sub)
+			if len(b.subscriptions[auctionID]) == 0 {
+				delete(b.subscriptions, auctionID)
+			}
+			b.mu.Unlock()
+			close(sub.done)
+		})
+	}
+}
+
+func (b *MemoryEventBus) IsLeader(auctionID uuid.UUID) bool {
+	return true
+}
+
+// subscription queues the events of a subscriber, so publishing never waits
+// on it. A room can therefore publish events to its own subscription.
+type subscription struct {
+	events chan RoomEvent
+
+	mu    sync.Mutex
+	queue []RoomEvent
+	ready chan struct{}
+	done  chan struct{}
+}
+
+func (s *subscription) push(event RoomEvent) {
+	s.mu.Lock()
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) pump() {
+	for {
+		select {
+		case <-s.ready:
+		case <-s.done:
+			return
+		}
+
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+		for _, event := range queue {
+			select {
+			case s.events <- event:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// recordingEventBus is a single instance EventBus that keeps every event
+// published on it.
+type recordingEventBus struct {
+	*MemoryEventBus
+	leader bool
+
+	mu        sync.Mutex
+	published []RoomEvent
+}
+
+func newRecordingEventBus() *recordingEventBus {
+	return &recordingEventBus{MemoryEventBus: NewMemoryEventBus(), leader: true}
+}
+
+func (b *recordingEventBus) Publish(ctx context.Context, auctionID uuid.UUID, event RoomEvent) error {
+	b.mu.Lock()
+	b.published = append(b.published, event)
+	b.mu.Unlock()
+	return b.MemoryEventBus.Publish(ctx, auctionID, event)
+}
+
+func (b *recordingEventBus) IsLeader(auctionID uuid.UUID) bool {
+	return b.leader
+}
+
+// Published returns the events published so far.
+func (b *recordingEventBus) Published() []RoomEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]RoomEvent(nil), b.published...)
+}
+
+func TestMemoryEventBusDeliversInOrder(t *testing.T) {
+	bus := NewMemoryEventBus()
+	auctionID := uuid.New()
+	events, unsubscribe := bus.Subscribe(auctionID)
+	defer unsubscribe()
+
+	// nobody reads yet, which must not hold up publishing
+	for i := range 10 {
+		bus.Publish(context.Background(), auctionID, RoomEvent{Message: Message{RequestID: string(rune('a' + i))}})
+	}
+	bus.Publish(context.Background(), uuid.New(), RoomEvent{Message: Message{RequestID: "other auction"}})
+
+	for i := range 10 {
+		select {
+		case event := <-events:
+			if want := string(rune('a' + i)); event.Message.RequestID != want {
+				t.Fatalf("event %d = %q, want %q", i, event.Message.RequestID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d was not delivered", i)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %q", event.Message.RequestID)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestRoomEventIsFor(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	tests := []struct {
+		event RoomEvent
+		alice bool
+		bob   bool
+	}{
+		{event: RoomEvent{}, alice: true, bob: true},
+		{event: RoomEvent{To: &alice}, alice: true},
+		{event: RoomEvent{Except: &alice}, bob: true},
+	}
+	for i, tt := range tests {
+		if got := tt.event.isFor(alice); got != tt.alice {
+			t.Errorf("event %d isFor(alice) = %v", i, got)
+		}
+		if got := tt.event.isFor(bob); got != tt.bob {
+			t.Errorf("event %d isFor(bob) = %v", i, got)
+		}
+	}
+}
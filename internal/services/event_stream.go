@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keepAlivePeriod keeps idle event streams from being closed by proxies.
+const keepAlivePeriod = 15 * time.Second
+
+// StreamEvents writes the messages of a client without a websocket
+// connection to w as server-sent events, identified by their Epoch and Seq
+// so browsers can resume with Last-Event-ID. It returns once the auction ends, the
+// room drops the client or ctx is done.
+func (c *Client) StreamEvents(ctx context.Context, w http.ResponseWriter) error {
+	defer c.unregister()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(keepAlivePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case message := <-c.Send:
+			encoded, err := c.encode(message)
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(encoded)
+			if err != nil {
+				return err
+			}
+			// unnumbered messages, like ticks, must not reset the
+			// Last-Event-ID of the browser
+			if message.Seq > 0 {
+				if _, err := fmt.Fprintf(w, "id: %s\n", EventID(message)); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return err
+			}
+			if err := rc.Flush(); err != nil {
+				return err
+			}
+			if message.Kind == AuctionEnded || message.Kind == AuctionCancelled {
+				return nil
+			}
+		case <-c.disconnect:
+			fmt.Fprintf(w, "event: close\ndata: %s\n\n", c.closeText)
+			return rc.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return err
+			}
+			if err := rc.Flush(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// EventID identifies message in an event stream, as "epoch:seq".
+func EventID(message Message) string {
+	return message.Epoch + ":" + strconv.FormatUint(message.Seq, 10)
+}
+
+// ParseEventID reads an event ID written by EventID. A bare sequence number
+// has no epoch.
+func ParseEventID(id string) (epoch string, seq uint64, err error) {
+	raw := id
+	if i := strings.LastIndexByte(id, ':'); i >= 0 {
+		epoch, raw = id[:i], id[i+1:]
+	}
+	seq, err = strconv.ParseUint(raw, 10, 64)
+	return epoch, seq, err
+}
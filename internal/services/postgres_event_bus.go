@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LucasLCabral/go-bid/internal/store/pgstore"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// auctionsChannel carries the events of LobbyID, such as the auctions
+	// created by any instance.
+	auctionsChannel = "auctions"
+
+	leaderRetry = 5 * time.Second
+	listenRetry = time.Second
+
+	// maxNotifyPayload keeps notifications below the 8000 byte limit of
+	// Postgres. Larger events, such as the ranking of a sealed-bid auction,
+	// are stored in room_events for roomEventRetention and notified by
+	// reference.
+	maxNotifyPayload   = 7900
+	roomEventRetention = time.Hour
+)
+
+// eventRef is the notification of an event stored in room_events. Other
+// notifications carry the event itself, and no Ref.
+type eventRef struct {
+	Origin uuid.UUID `json:"origin"`
+	Ref    int64     `json:"ref,omitempty"`
+}
+
+// PostgresEventBus connects the auction rooms of every running instance
+// through Postgres LISTEN/NOTIFY, with one channel per auction. Each auction
+// is led by the instance holding its advisory lock, which accepts its bids
+// and settles it; the rooms of the other instances forward bid requests to
+// it.
+type PostgresEventBus struct {
+	local    *MemoryEventBus
+	pool     *pgxpool.Pool
+	queries  *pgstore.Queries
+	instance uuid.UUID
+
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]int
+	leading     map[uuid.UUID]bool
+	commands    []string
+	wake        chan struct{}
+	claim       chan struct{}
+}
+
+func NewPostgresEventBus(pool *pgxpool.Pool) *PostgresEventBus {
+	return &PostgresEventBus{
+		local:       NewMemoryEventBus(),
+		pool:        pool,
+		queries:     pgstore.New(pool),
+		instance:    uuid.New(),
+		subscribers: make(map[uuid.UUID]int),
+		leading:     make(map[uuid.UUID]bool),
+		wake:        make(chan struct{}, 1),
+		claim:       make(chan struct{}, 1),
+	}
+}
+
+func auctionChannel(auctionID uuid.UUID) string {
+	if auctionID == LobbyID {
+		return auctionsChannel
+	}
+	return "auction_" + auctionID.String()
+}
+
+func channelAuction(channel string) (uuid.UUID, error) {
+	if channel == auctionsChannel {
+		return LobbyID, nil
+	}
+	return uuid.Parse(strings.TrimPrefix(channel, "auction_"))
+}
+
+// auctionLockKey is the advisory lock held by the instance leading
+// auctionID.
+func auctionLockKey(auctionID uuid.UUID) int64 {
+	return int64(binary.BigEndian.Uint64(auctionID[:8]))
+}
+
+func (b *PostgresEventBus) IsLeader(auctionID uuid.UUID) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.leading[auctionID]
+}
+
+// Run competes for the leadership of the auctions subscribed to and relays the events published by the other
+// instances to the subscribers of this one until ctx is done.
+func (b *PostgresEventBus) Run(ctx context.Context) {
+	go b.lead(ctx)
+
+	for ctx.Err() == nil {
+		if err := b.listen(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("auction listener failed", "Error", err)
+			select {
+			case <-time.After(listenRetry):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// lead tries to take the lock of every auction subscribed to on this
+// instance, and releases the locks of the auctions no longer subscribed to.
+// The locks belong to a single connection, and are released by Postgres when
+// it goes away, letting other instances take over.
+func (b *PostgresEventBus) lead(ctx context.Context) {
+	var conn *pgx.Conn
+	defer func() {
+		b.resign()
+		if conn != nil {
+			conn.Close(context.Background())
+		}
+	}()
+
+	ticker := time.NewTicker(leaderRetry)
+	defer ticker.Stop()
+	for {
+		var err error
+		if conn == nil {
+			var pooled *pgxpool.Conn
+			if pooled, err = b.pool.Acquire(ctx); err == nil {
+				// the locks belong to the session, so the connection must
+				// never go back to the pool
+				conn = pooled.Hijack()
+			}
+		}
+		if err == nil {
+			err = b.claimLocks(ctx, conn)
+		}
+		if err != nil && ctx.Err() == nil {
+			slog.Error("failed to hold the auction locks", "Error", err)
+			b.resign()
+			if conn != nil {
+				conn.Close(context.Background())
+				conn = nil
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-b.claim:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// claimLocks brings the locks held on conn in line with the auctions
+// subscribed to.
+func (b *PostgresEventBus) claimLocks(ctx context.Context, conn *pgx.Conn) error {
+	if err := conn.Ping(ctx); err != nil {
+		return err
+	}
+
+	var claims, releases []uuid.UUID
+	b.mu.Lock()
+	for auctionID := range b.subscribers {
+		if auctionID != LobbyID && !b.leading[auctionID] {
+			claims = append(claims, auctionID)
+		}
+	}
+	for auctionID := range b.leading {
+		if b.subscribers[auctionID] == 0 {
+			releases = append(releases, auctionID)
+		}
+	}
+	b.mu.Unlock()
+
+	queries := pgstore.New(conn)
+	for _, auctionID := range releases {
+		if _, err := queries.AdvisoryUnlock(ctx, auctionLockKey(auctionID)); err != nil {
+			return err
+		}
+		b.mu.Lock()
+		delete(b.leading, auctionID)
+		b.mu.Unlock()
+	}
+	for _, auctionID := range claims {
+		locked, err := queries.TryAdvisoryLock(ctx, auctionLockKey(auctionID))
+		if err != nil {
+			return err
+		}
+		if locked {
+			slog.Info("Instance now leads the auction", "Instance", b.instance, "Auction", auctionID)
+			b.mu.Lock()
+			b.leading[auctionID] = true
+			b.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// resign gives up the leadership of every auction, once their locks are
+// gone.
+func (b *PostgresEventBus) resign() {
+	b.mu.Lock()
+	clear(b.leading)
+	b.mu.Unlock()
+}
+
+// listen relays notifications to the subscribers of this instance until the
+// listening connection fails.
+func (b *PostgresEventBus) listen(ctx context.Context) error {
+	pooled, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	// a new connection listens to nothing yet
+	b.mu.Lock()
+	b.commands = nil
+	for auctionID := range b.subscribers {
+		b.commands = append(b.commands, listenCommand(auctionChannel(auctionID)))
+	}
+	b.mu.Unlock()
+
+	for {
+		b.mu.Lock()
+		commands := b.commands
+		b.commands = nil
+		b.mu.Unlock()
+		for _, command := range commands {
+			if _, err := conn.Exec(ctx, command); err != nil {
+				return err
+			}
+		}
+
+		// stop waiting when auctions are subscribed to or left, so their
+		// channels are listened to right away
+		waitCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-b.wake:
+				cancel()
+			case <-waitCtx.Done():
+			}
+		}()
+		notification, err := conn.WaitForNotification(waitCtx)
+		woken := waitCtx.Err() != nil
+		cancel()
+		if err != nil {
+			if woken && ctx.Err() == nil {
+				continue
+			}
+			return err
+		}
+		b.dispatch(ctx, notification)
+	}
+}
+
+func listenCommand(channel string) string {
+	return "LISTEN " + pgx.Identifier{channel}.Sanitize()
+}
+
+func unlistenCommand(channel string) string {
+	return "UNLISTEN " + pgx.Identifier{channel}.Sanitize()
+}
+
+// dispatch hands an event published by another instance to the
+// subscribers of its auction.
+func (b *PostgresEventBus) dispatch(ctx context.Context, notification *pgconn.Notification) {
+	auctionID, err := channelAuction(notification.Channel)
+	if err != nil {
+		return
+	}
+	payload := []byte(notification.Payload)
+	var ref eventRef
+	if err := json.Unmarshal(payload, &ref); err != nil {
+		slog.Error("invalid auction notification", "Channel", notification.Channel, "Error", err)
+		return
+	}
+	if ref.Origin == b.instance {
+		return
+	}
+	if ref.Ref != 0 {
+		if payload, err = b.queries.GetRoomEventPayload(ctx, ref.Ref); err != nil {
+			slog.Error("failed to load auction event", "Channel", notification.Channel, "Ref", ref.Ref, "Error", err)
+			return
+		}
+	}
+	var event RoomEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		slog.Error("invalid auction notification", "Channel", notification.Channel, "Error", err)
+		return
+	}
+	b.local.Publish(ctx, auctionID, event)
+}
+
+// Publish hands event to the subscribers of this instance right away and
+// relays it to the other instances.
+func (b *PostgresEventBus) Publish(ctx context.Context, auctionID uuid.UUID, event RoomEvent) error {
+	event.Origin = b.instance
+	b.local.Publish(ctx, auctionID, event)
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if len(payload) >= maxNotifyPayload {
+		if payload, err = b.store(ctx, auctionID, payload); err != nil {
+			return err
+		}
+	}
+	return b.queries.Notify(ctx, pgstore.NotifyParams{
+		Channel: auctionChannel(auctionID),
+		Payload: string(payload),
+	})
+}
+
+// store keeps an event too large for a notification in the database and
+// returns the notification referring to it. Events older than
+// roomEventRetention are dropped on the way.
+func (b *PostgresEventBus) store(ctx context.Context, auctionID uuid.UUID, payload []byte) ([]byte, error) {
+	if err := b.queries.DeleteRoomEventsBefore(ctx, time.Now().Add(-roomEventRetention)); err != nil {
+		return nil, err
+	}
+	id, err := b.queries.CreateRoomEvent(ctx, pgstore.CreateRoomEventParams{
+		AuctionID: auctionID,
+		Payload:   payload,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(eventRef{Origin: b.instance, Ref: id})
+}
+
+func (b *PostgresEventBus) Subscribe(auctionID uuid.UUID) (<-chan RoomEvent, func()) {
+	events, unsubscribe := b.local.Subscribe(auctionID)
+
+	b.mu.Lock()
+	b.subscribers[auctionID]++
+	if b.subscribers[auctionID] == 1 {
+		b.commands = append(b.commands, listenCommand(auctionChannel(auctionID)))
+	}
+	b.mu.Unlock()
+	b.signal()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			unsubscribe()
+
+			b.mu.Lock()
+			b.subscribers[auctionID]--
+			if b.subscribers[auctionID] == 0 {
+				delete(b.subscribers, auctionID)
+				b.commands = append(b.commands, unlistenCommand(auctionChannel(auctionID)))
+			}
+			b.mu.Unlock()
+			b.signal()
+		})
+	}
+}
+
+// signal tells the listener and the leader loop that the auctions subscribed
+// to changed.
+func (b *PostgresEventBus) signal() {
+	for _, c := range []chan struct{}{b.wake, b.claim} {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
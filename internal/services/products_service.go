@@ -5,7 +5,9 @@ import (
 	"errors"
 	"time"
 
+	"github.com/LucasLCabral/go-bid/internal/money"
 	"github.com/LucasLCabral/go-bid/internal/store/pgstore"
+	"github.com/LucasLCabral/go-bid/internal/usecase/product"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -23,25 +25,45 @@ func NewProductsService(pool *pgxpool.Pool) *ProductsService {
 	}
 }
 
-func (ps *ProductsService) CreateProduct(
-	ctx context.Context,
-	sellerId uuid.UUID,
-	productName,
-	description string,
-	baseprice float64,
-	auctionEnd time.Time,
-) (uuid.UUID, error) {
-	id, err := ps.queries.CreateProduct(ctx, pgstore.CreateProductParams{
+func (ps *ProductsService) CreateProduct(ctx context.Context, sellerId uuid.UUID, req product.CreateProductReq) (pgstore.Product, error) {
+	auctionType := req.AuctionType
+	if auctionType == "" {
+		auctionType = pgstore.AuctionTypeEnglish
+	}
+	auctionStart := req.AuctionStart
+	if auctionStart.IsZero() {
+		auctionStart = time.Now()
+	}
+	created, err := ps.queries.CreateProduct(ctx, pgstore.CreateProductParams{
 		SellerID:    sellerId,
-		ProductName: productName,
-		Description: description,
-		BasePrice:   baseprice,
-		AuctionEnd:  auctionEnd,
+		ProductName: req.ProductName,
+		Description: req.Description,
+		BasePrice:   req.BasePrice,
+		AuctionEnd:  req.AuctionEnd,
+
+		SoftCloseWindowSeconds:    req.SoftCloseWindowSeconds,
+		SoftCloseExtensionSeconds: req.SoftCloseExtensionSeconds,
+		BidIncrement:              req.BidIncrement,
+		ReservePrice:              optionalAmount(req.ReservePrice),
+		BuyNowPrice:               optionalAmount(req.BuyNowPrice),
+		AuctionType:               auctionType,
+		DutchPriceStep:            req.DutchPriceStep,
+		DutchStepIntervalSeconds:  req.DutchStepIntervalSeconds,
+		AuctionStart:              auctionStart,
+		Currency:                  req.Currency,
 	})
 	if err != nil {
-		return uuid.UUID{}, err
+		return pgstore.Product{}, err
 	}
-	return id, nil
+	return created, nil
+}
+
+// optionalAmount stores a zero amount as NULL.
+func optionalAmount(amount money.Amount) *money.Amount {
+	if amount == 0 {
+		return nil
+	}
+	return &amount
 }
 
 var ErrProductNotFound = errors.New("product not found")
@@ -56,3 +78,21 @@ func (ps *ProductsService) GetProductByID(ctx context.Context, productID uuid.UU
 	}
 	return product, nil
 }
+
+func (ps *ProductsService) ListActiveAuctions(ctx context.Context) ([]pgstore.Product, error) {
+	products, err := ps.queries.ListActiveAuctions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// ListOverdueAuctions returns the auctions that ended without being settled,
+// such as those ending while no server was running.
+func (ps *ProductsService) ListOverdueAuctions(ctx context.Context) ([]pgstore.Product, error) {
+	products, err := ps.queries.ListOverdueAuctions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
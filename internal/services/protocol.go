@@ -0,0 +1,399 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LucasLCabral/go-bid/internal/money"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Versions of the protocol spoken with room clients. Version 2 wraps the
+// typed Payload of every event in an Envelope naming the event with a
+// string. Version 1 sends the Message built from that payload as is, with
+// numeric kinds.
+const (
+	ProtocolV1 = 1
+	ProtocolV2 = 2
+)
+
+// subprotocols lets websocket clients pick a version with
+// Sec-WebSocket-Protocol.
+var subprotocols = map[string]int{
+	"gobid.v1": ProtocolV1,
+	"gobid.v2": ProtocolV2,
+}
+
+var (
+	ErrUnsupportedProtocol = errors.New("unsupported protocol version")
+	ErrUnknownRequest      = errors.New("unknown request type")
+)
+
+// NegotiateProtocol picks the protocol version of a subscription: the v query
+// parameter when given, else the first supported websocket subprotocol
+// offered by the client, else ProtocolV1. subprotocol is the one to accept,
+// if any.
+func NegotiateProtocol(r *http.Request) (version int, subprotocol string, err error) {
+	if raw := r.URL.Query().Get("v"); raw != "" {
+		version, err := strconv.Atoi(raw)
+		if err != nil || version != ProtocolV1 && version != ProtocolV2 {
+			return 0, "", fmt.Errorf("%w: %q", ErrUnsupportedProtocol, raw)
+		}
+		return version, "", nil
+	}
+	for _, offered := range websocket.Subprotocols(r) {
+		if version, ok := subprotocols[offered]; ok {
+			return version, offered, nil
+		}
+	}
+	return ProtocolV1, "", nil
+}
+
+// Envelope carries every version 2 message. Seq and Epoch are only set on
+// the events a client can resume from, and RequestID on requests and the
+// replies to them.
+type Envelope struct {
+	Version   int             `json:"v"`
+	Type      string          `json:"type"`
+	RequestID string          `json:"request_id,omitempty"`
+	Seq       uint64          `json:"seq,omitempty"`
+	Epoch     string          `json:"epoch,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// eventTypes names every kind of message in version 2. Unlike kinds, names
+// never depend on the order they were added in.
+var eventTypes = map[MessageKind]string{
+	PlaceBid:              "place_bid",
+	SuccessfullyPlacedBid: "bid_accepted",
+	FailedToPlaceBid:      "bid_rejected",
+	InvalidJson:           "invalid_request",
+	NewBidPlaced:          "new_bid",
+	AuctionEnded:          "auction_ended",
+	AuctionExtended:       "auction_extended",
+	ReserveNotMet:         "reserve_not_met",
+	ReserveMet:            "reserve_met",
+	BuyNow:                "buy_now",
+	FailedToBuyNow:        "buy_now_rejected",
+	AcceptPrice:           "accept_price",
+	PriceUpdated:          "price_updated",
+	AuctionStarted:        "auction_started",
+	AuctionCancelled:      "auction_cancelled",
+	BidRetracted:          "bid_retracted",
+	AuctionSnapshot:       "auction_snapshot",
+	AuctionTick:           "tick",
+	TimeSync:              "time_sync",
+	TimeSyncReply:         "time_sync_reply",
+}
+
+// requestKinds lists the messages clients can send in version 2.
+var requestKinds = map[string]MessageKind{
+	"place_bid":    PlaceBid,
+	"buy_now":      BuyNow,
+	"accept_price": AcceptPrice,
+	"time_sync":    TimeSync,
+}
+
+// PlaceBidRequest is the payload of place_bid. Setting MaxAmount registers a
+// maximum bid instead.
+type PlaceBidRequest struct {
+	Amount    money.Amount   `json:"amount,omitempty"`
+	MaxAmount money.Amount   `json:"max_amount,omitempty"`
+	Currency  money.Currency `json:"currency,omitempty"`
+}
+
+// TimeSyncRequest is the payload of time_sync. ClientTime is echoed back as
+// is.
+type TimeSyncRequest struct {
+	ClientTime int64 `json:"client_time"`
+}
+
+// Payload is the typed content of a message sent to clients. Messages are
+// built from their payload by newMessage, so both versions of the protocol
+// always carry the same fields.
+type Payload interface {
+	// message returns the payload as the fields of a version 1 message.
+	message() Message
+}
+
+// newMessage builds the message of kind carrying payload.
+func newMessage(kind MessageKind, payload Payload) Message {
+	message := payload.message()
+	message.Kind = kind
+	message.payload = payload
+	return message
+}
+
+// payloadDecoders reads the payload of every kind of message sent to
+// clients, such as the messages relayed by other instances.
+var payloadDecoders = map[MessageKind]func(data []byte) (Payload, error){
+	SuccessfullyPlacedBid: decodePayload[BidPayload],
+	NewBidPlaced:          decodePayload[BidPayload],
+	FailedToPlaceBid:      decodePayload[RejectionPayload],
+	FailedToBuyNow:        decodePayload[RejectionPayload],
+	InvalidJson:           decodePayload[RejectionPayload],
+	ReserveMet:            decodePayload[NoticePayload],
+	ReserveNotMet:         decodePayload[NoticePayload],
+	AuctionStarted:        decodePayload[PricePayload],
+	PriceUpdated:          decodePayload[PricePayload],
+	AuctionExtended:       decodePayload[AuctionExtendedPayload],
+	AuctionEnded:          decodePayload[AuctionEndedPayload],
+	AuctionCancelled:      decodePayload[AuctionCancelledPayload],
+	BidRetracted:          decodePayload[BidRetractedPayload],
+	AuctionSnapshot:       decodePayload[*RoomSnapshot],
+	AuctionTick:           decodePayload[TickPayload],
+	TimeSyncReply:         decodePayload[TimeSyncReplyPayload],
+}
+
+func decodePayload[P Payload](data []byte) (Payload, error) {
+	var payload P
+	err := json.Unmarshal(data, &payload)
+	return payload, err
+}
+
+// BidPayload is the payload of bid_accepted and new_bid.
+type BidPayload struct {
+	BidderID uuid.UUID      `json:"bidder_id"`
+	Amount   money.Amount   `json:"amount,omitempty"`
+	Currency money.Currency `json:"currency,omitempty"`
+	Message  string         `json:"message"`
+}
+
+func (p BidPayload) message() Message {
+	return Message{
+		UserId:    p.BidderID,
+		Message:   p.Message,
+		BidAmount: p.Amount,
+		Currency:  p.Currency,
+	}
+}
+
+// RejectionPayload is the payload of bid_rejected, buy_now_rejected and
+// invalid_request.
+type RejectionPayload struct {
+	Error      string         `json:"error"`
+	MinNextBid money.Amount   `json:"min_next_bid,omitempty"`
+	Currency   money.Currency `json:"currency,omitempty"`
+}
+
+func (p RejectionPayload) message() Message {
+	return Message{
+		Message:    p.Error,
+		MinNextBid: p.MinNextBid,
+		Currency:   p.Currency,
+	}
+}
+
+// NoticePayload is the payload of reserve_met and reserve_not_met.
+type NoticePayload struct {
+	Message string `json:"message"`
+}
+
+func (p NoticePayload) message() Message {
+	return Message{Message: p.Message}
+}
+
+// PricePayload is the payload of auction_started and price_updated. Price is
+// only set on Dutch auctions.
+type PricePayload struct {
+	Price      money.Amount   `json:"price,omitempty"`
+	Currency   money.Currency `json:"currency,omitempty"`
+	AuctionEnd *time.Time     `json:"auction_end,omitempty"`
+	Message    string         `json:"message"`
+}
+
+func (p PricePayload) message() Message {
+	return Message{
+		Message:    p.Message,
+		BidAmount:  p.Price,
+		Currency:   p.Currency,
+		AuctionEnd: p.AuctionEnd,
+	}
+}
+
+// AuctionExtendedPayload is the payload of auction_extended.
+type AuctionExtendedPayload struct {
+	AuctionEnd *time.Time `json:"auction_end"`
+	Message    string     `json:"message"`
+}
+
+func (p AuctionExtendedPayload) message() Message {
+	return Message{
+		Message:    p.Message,
+		AuctionEnd: p.AuctionEnd,
+	}
+}
+
+// AuctionEndedPayload is the payload of auction_ended.
+type AuctionEndedPayload struct {
+	WinnerID       *uuid.UUID     `json:"winner_id,omitempty"`
+	FinalPrice     money.Amount   `json:"final_price,omitempty"`
+	Currency       money.Currency `json:"currency,omitempty"`
+	BoughtOutright bool           `json:"bought_outright,omitempty"`
+	Reason         string         `json:"reason,omitempty"`
+	Results        []RankedBid    `json:"results,omitempty"`
+	Message        string         `json:"message"`
+}
+
+func (p AuctionEndedPayload) message() Message {
+	message := Message{
+		Message:        p.Message,
+		BidAmount:      p.FinalPrice,
+		Currency:       p.Currency,
+		BoughtOutright: p.BoughtOutright,
+		Reason:         p.Reason,
+		Results:        p.Results,
+	}
+	if p.WinnerID != nil {
+		message.UserId = *p.WinnerID
+	}
+	return message
+}
+
+// AuctionCancelledPayload is the payload of auction_cancelled.
+type AuctionCancelledPayload struct {
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p AuctionCancelledPayload) message() Message {
+	return Message{
+		Message: p.Message,
+		Reason:  p.Reason,
+	}
+}
+
+// BidRetractedPayload is the payload of bid_retracted.
+type BidRetractedPayload struct {
+	BidderID   uuid.UUID      `json:"bidder_id"`
+	LeadingBid money.Amount   `json:"leading_bid,omitempty"`
+	MinNextBid money.Amount   `json:"min_next_bid"`
+	Currency   money.Currency `json:"currency"`
+	Reason     string         `json:"reason,omitempty"`
+	Message    string         `json:"message"`
+}
+
+func (p BidRetractedPayload) message() Message {
+	return Message{
+		UserId:     p.BidderID,
+		Message:    p.Message,
+		BidAmount:  p.LeadingBid,
+		MinNextBid: p.MinNextBid,
+		Currency:   p.Currency,
+		Reason:     p.Reason,
+	}
+}
+
+// TickPayload is the payload of tick.
+type TickPayload struct {
+	ServerTime       *time.Time `json:"server_time"`
+	AuctionEnd       *time.Time `json:"auction_end"`
+	SecondsRemaining *int64     `json:"seconds_remaining"`
+}
+
+func (p TickPayload) message() Message {
+	return Message{
+		ServerTime:       p.ServerTime,
+		AuctionEnd:       p.AuctionEnd,
+		SecondsRemaining: p.SecondsRemaining,
+	}
+}
+
+// TimeSyncReplyPayload is the payload of time_sync_reply.
+type TimeSyncReplyPayload struct {
+	ServerTime *time.Time `json:"server_time"`
+	ClientTime int64      `json:"client_time"`
+}
+
+func (p TimeSyncReplyPayload) message() Message {
+	return Message{
+		ServerTime: p.ServerTime,
+		ClientTime: p.ClientTime,
+	}
+}
+
+// encodeV2 wraps the payload of message in a version 2 envelope.
+func encodeV2(message Message) (Envelope, error) {
+	eventType, ok := eventTypes[message.Kind]
+	if !ok || message.payload == nil {
+		return Envelope{}, fmt.Errorf("message kind %d has no event type", message.Kind)
+	}
+	payload, err := json.Marshal(message.payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		Version:   ProtocolV2,
+		Type:      eventType,
+		RequestID: message.RequestID,
+		Seq:       message.Seq,
+		Epoch:     message.Epoch,
+		Payload:   payload,
+	}, nil
+}
+
+// decodeV2 reads a version 2 request. The message keeps the request ID of the
+// envelope even when the request is invalid, so the error can echo it.
+func decodeV2(data []byte) (Message, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return Message{}, err
+	}
+	message := Message{RequestID: envelope.RequestID}
+	if envelope.Version != ProtocolV2 {
+		return message, fmt.Errorf("%w: %d", ErrUnsupportedProtocol, envelope.Version)
+	}
+	kind, ok := requestKinds[envelope.Type]
+	if !ok {
+		return message, fmt.Errorf("%w: %q", ErrUnknownRequest, envelope.Type)
+	}
+	message.Kind = kind
+
+	switch kind {
+	case PlaceBid:
+		var request PlaceBidRequest
+		if err := unmarshalPayload(envelope.Payload, &request); err != nil {
+			return message, err
+		}
+		message.BidAmount = request.Amount
+		message.MaxAmount = request.MaxAmount
+		message.Currency = request.Currency
+	case TimeSync:
+		var request TimeSyncRequest
+		if err := unmarshalPayload(envelope.Payload, &request); err != nil {
+			return message, err
+		}
+		message.ClientTime = request.ClientTime
+	}
+	return message, nil
+}
+
+func unmarshalPayload(payload json.RawMessage, v any) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// encode turns message into what the client reads, in its protocol version.
+func (c *Client) encode(message Message) (any, error) {
+	if c.Version == ProtocolV2 {
+		return encodeV2(message)
+	}
+	return message, nil
+}
+
+// decode reads a request of the client, in its protocol version.
+func (c *Client) decode(data []byte) (Message, error) {
+	if c.Version == ProtocolV2 {
+		return decodeV2(data)
+	}
+	var message Message
+	err := json.Unmarshal(data, &message)
+	return message, err
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/LucasLCabral/go-bid/internal/money"
+	"github.com/google/uuid"
+)
+
+func TestDecodeV2(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Message
+		err  error
+	}{
+		{
+			name: "place bid",
+			data: `{"v":2,"type":"place_bid","request_id":"r1","payload":{"amount":"12.50","currency":"USD"}}`,
+			want: Message{Kind: PlaceBid, RequestID: "r1", BidAmount: 12*money.Unit + 50*money.Cent, Currency: "USD"},
+		},
+		{
+			name: "max bid",
+			data: `{"v":2,"type":"place_bid","payload":{"max_amount":"40"}}`,
+			want: Message{Kind: PlaceBid, MaxAmount: 40 * money.Unit},
+		},
+		{
+			name: "time sync",
+			data: `{"v":2,"type":"time_sync","request_id":"r2","payload":{"client_time":1234}}`,
+			want: Message{Kind: TimeSync, RequestID: "r2", ClientTime: 1234},
+		},
+		{
+			name: "no payload",
+			data: `{"v":2,"type":"buy_now"}`,
+			want: Message{Kind: BuyNow},
+		},
+		{
+			name: "version 1",
+			data: `{"v":1,"type":"place_bid","request_id":"r3"}`,
+			want: Message{RequestID: "r3"},
+			err:  ErrUnsupportedProtocol,
+		},
+		{
+			name: "no version",
+			data: `{"type":"place_bid"}`,
+			err:  ErrUnsupportedProtocol,
+		},
+		{
+			name: "event sent to clients",
+			data: `{"v":2,"type":"new_bid","request_id":"r4"}`,
+			want: Message{RequestID: "r4"},
+			err:  ErrUnknownRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeV2([]byte(tt.data))
+			if tt.err != nil && !errors.Is(err, tt.err) || tt.err == nil && err != nil {
+				t.Fatalf("decodeV2 error = %v, want %v", err, tt.err)
+			}
+			if got.Kind != tt.want.Kind || got.RequestID != tt.want.RequestID ||
+				got.BidAmount != tt.want.BidAmount || got.MaxAmount != tt.want.MaxAmount ||
+				got.Currency != tt.want.Currency || got.ClientTime != tt.want.ClientTime {
+				t.Errorf("decodeV2 = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeV2(t *testing.T) {
+	bidderID := uuid.New()
+	message := newMessage(NewBidPlaced, BidPayload{
+		BidderID: bidderID,
+		Amount:   12*money.Unit + 50*money.Cent,
+		Currency: "USD",
+		Message:  "new bid",
+	})
+	message.Seq, message.Epoch = 7, "epoch"
+
+	envelope, err := encodeV2(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Version != ProtocolV2 || envelope.Type != "new_bid" || envelope.Seq != 7 || envelope.Epoch != "epoch" {
+		t.Errorf("envelope = %+v", envelope)
+	}
+	var payload BidPayload
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.BidderID != bidderID || payload.Amount != message.BidAmount || payload.Currency != "USD" {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	if _, err := encodeV2(Message{Kind: NewBidPlaced}); err == nil {
+		t.Error("encodeV2 encoded a message without payload")
+	}
+}
+
+// Every message sent to clients can be relayed by another instance.
+func TestPayloadDecoders(t *testing.T) {
+	requests := make(map[MessageKind]bool)
+	for _, kind := range requestKinds {
+		requests[kind] = true
+	}
+	for kind, eventType := range eventTypes {
+		if _, ok := payloadDecoders[kind]; !ok && !requests[kind] {
+			t.Errorf("%s has no payload decoder", eventType)
+		}
+	}
+}
+
+func TestRoomEventKeepsPayload(t *testing.T) {
+	userID := uuid.New()
+	event := RoomEvent{
+		Message: reply(Message{UserId: userID, RequestID: "r1"}, FailedToPlaceBid, RejectionPayload{
+			Error:      ErrBidAmountTooLow.Error(),
+			MinNextBid: 10 * money.Unit,
+			Currency:   "USD",
+		}),
+		To: &userID,
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded RoomEvent
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.To == nil || *decoded.To != userID || decoded.Message.RequestID != "r1" {
+		t.Errorf("decoded = %+v", decoded)
+	}
+
+	want, err := encodeV2(event.Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := encodeV2(decoded.Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Payload) != string(want.Payload) || got.Type != want.Type {
+		t.Errorf("relayed envelope = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"expvar"
+	"fmt"
+	"log/slog"
+)
+
+// SlowClientPolicy decides what a room does with a message for a client
+// whose send buffer is full, so a stalled connection never holds up the
+// room.
+type SlowClientPolicy int
+
+const (
+	// DropOldest discards the oldest buffered message to make room.
+	DropOldest SlowClientPolicy = iota
+
+	// CoalescePrice discards the buffered price updates, which the new one
+	// supersedes, and likewise for ticks. Clients falling behind on any
+	// other message are disconnected, as those cannot be skipped.
+	CoalescePrice
+
+	// DisconnectSlow closes the connection of the client, which can then
+	// reconnect and catch up.
+	DisconnectSlow
+)
+
+var slowClientPolicies = map[string]SlowClientPolicy{
+	"drop_oldest": DropOldest,
+	"coalesce":    CoalescePrice,
+	"disconnect":  DisconnectSlow,
+}
+
+// ParseSlowClientPolicy reads a policy by name. An empty name selects
+// DropOldest.
+func ParseSlowClientPolicy(name string) (SlowClientPolicy, error) {
+	if name == "" {
+		return DropOldest, nil
+	}
+	policy, ok := slowClientPolicies[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown slow client policy %q", name)
+	}
+	return policy, nil
+}
+
+// slowClients counts, under /debug/vars, how often each policy fired.
+var slowClients = expvar.NewMap("auction_slow_clients")
+
+// send hands message to the client without ever blocking the room, applying
+// the policy of the client when its buffer is full. It reports false when
+// the client has to be disconnected.
+func (c *Client) send(message Message) bool {
+	select {
+	case c.Send <- message:
+		return true
+	default:
+	}
+
+	switch c.Policy {
+	case DropOldest:
+		// the room is the only sender, so dropping one message always makes
+		// room for the next
+		select {
+		case <-c.Send:
+			slowClients.Add("dropped", 1)
+		default:
+		}
+		select {
+		case c.Send <- message:
+		default:
+		}
+		return true
+	case CoalescePrice:
+		if supersession(message) != "" && c.coalesce(message) {
+			return true
+		}
+	}
+	slowClients.Add("disconnected", 1)
+	slog.Info("Disconnecting slow client", "Client", c)
+	return false
+}
+
+// coalesce replaces the buffered messages of the client that message
+// supersedes with message, keeping every other message in order.
+func (c *Client) coalesce(message Message) bool {
+	var kept []Message
+	coalesced := 0
+	for drained := false; !drained; {
+		select {
+		case buffered := <-c.Send:
+			if supersession(buffered) == supersession(message) {
+				coalesced++
+			} else {
+				kept = append(kept, buffered)
+			}
+		default:
+			drained = true
+		}
+	}
+	slowClients.Add("coalesced", int64(coalesced))
+
+	for _, buffered := range append(kept, message) {
+		select {
+		case c.Send <- buffered:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// supersession groups the messages that are outdated by the next message of
+// their group, such as price updates. Other messages have no group.
+func supersession(message Message) string {
+	switch message.Kind {
+	case NewBidPlaced, PriceUpdated:
+		return "price"
+	case AuctionTick:
+		return "tick"
+	default:
+		return ""
+	}
+}
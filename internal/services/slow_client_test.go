@@ -0,0 +1,107 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// newSlowClient returns a client whose send buffer holds two messages.
+func newSlowClient(policy SlowClientPolicy) *Client {
+	client := NewClient(nil, nil, uuid.New(), policy, 0)
+	client.Send = make(chan Message, 2)
+	return client
+}
+
+// buffered drains the send buffer of client.
+func buffered(client *Client) []MessageKind {
+	var kinds []MessageKind
+	for {
+		select {
+		case message := <-client.Send:
+			kinds = append(kinds, message.Kind)
+		default:
+			return kinds
+		}
+	}
+}
+
+func equalKinds(a, b []MessageKind) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseSlowClientPolicy(t *testing.T) {
+	tests := map[string]SlowClientPolicy{
+		"":            DropOldest,
+		"drop_oldest": DropOldest,
+		"coalesce":    CoalescePrice,
+		"disconnect":  DisconnectSlow,
+	}
+	for name, want := range tests {
+		if got, err := ParseSlowClientPolicy(name); err != nil || got != want {
+			t.Errorf("ParseSlowClientPolicy(%q) = %d, %v, want %d", name, got, err, want)
+		}
+	}
+	if _, err := ParseSlowClientPolicy("block"); err == nil {
+		t.Error("ParseSlowClientPolicy accepted an unknown policy")
+	}
+}
+
+func TestClientSendDropOldest(t *testing.T) {
+	client := newSlowClient(DropOldest)
+	for _, kind := range []MessageKind{ReserveNotMet, NewBidPlaced, ReserveMet} {
+		if !client.send(Message{Kind: kind}) {
+			t.Fatalf("send(%d) asked to disconnect the client", kind)
+		}
+	}
+	if got, want := buffered(client), []MessageKind{NewBidPlaced, ReserveMet}; !equalKinds(got, want) {
+		t.Errorf("buffered = %v, want %v", got, want)
+	}
+}
+
+func TestClientSendCoalescePrice(t *testing.T) {
+	client := newSlowClient(CoalescePrice)
+	client.send(Message{Kind: NewBidPlaced})
+	client.send(Message{Kind: ReserveMet})
+	if !client.send(Message{Kind: PriceUpdated}) {
+		t.Fatal("price update asked to disconnect the client")
+	}
+	if got, want := buffered(client), []MessageKind{ReserveMet, PriceUpdated}; !equalKinds(got, want) {
+		t.Errorf("buffered = %v, want %v", got, want)
+	}
+
+	// messages that cannot be skipped
+	client.send(Message{Kind: NewBidPlaced})
+	client.send(Message{Kind: ReserveMet})
+	if client.send(Message{Kind: AuctionExtended}) {
+		t.Error("full client kept on a message that cannot be coalesced")
+	}
+
+	// nothing to coalesce with
+	client = newSlowClient(CoalescePrice)
+	client.send(Message{Kind: ReserveNotMet})
+	client.send(Message{Kind: ReserveMet})
+	if client.send(Message{Kind: AuctionTick}) {
+		t.Error("full client kept on a tick that superseded nothing")
+	}
+}
+
+func TestClientSendDisconnectSlow(t *testing.T) {
+	client := newSlowClient(DisconnectSlow)
+	client.send(Message{Kind: NewBidPlaced})
+	client.send(Message{Kind: NewBidPlaced})
+	if client.send(Message{Kind: NewBidPlaced}) {
+		t.Error("full client was not disconnected")
+	}
+	if got := buffered(client); len(got) != 2 {
+		t.Errorf("buffered = %v", got)
+	}
+}
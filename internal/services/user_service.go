@@ -73,3 +73,15 @@ func (us *UserService) AuthenticateUser(ctx context.Context, email, password str
 
 	return user.ID, nil
 }
+
+// IsAdmin reports whether userID may moderate other users' bids.
+func (us *UserService) IsAdmin(ctx context.Context, userID uuid.UUID) (bool, error) {
+	user, err := us.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return user.IsAdmin, nil
+}
@@ -8,19 +8,50 @@ package pgstore
 import (
 	"context"
 
+	"github.com/LucasLCabral/go-bid/internal/money"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countBidsByProductID = `-- name: CountBidsByProductID :one
+SELECT count(*) FROM bids
+WHERE product_id = $1 AND retracted_at IS NULL
+`
+
+func (q *Queries) CountBidsByProductID(ctx context.Context, productID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countBidsByProductID, productID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countRetractionsByBidderSince = `-- name: CountRetractionsByBidderSince :one
+SELECT count(*) FROM bids
+WHERE bidder_id = $1 AND voided_by IS NULL AND retracted_at >= $2
+`
+
+type CountRetractionsByBidderSinceParams struct {
+	BidderID    uuid.UUID          `json:"bidder_id"`
+	RetractedAt pgtype.Timestamptz `json:"retracted_at"`
+}
+
+func (q *Queries) CountRetractionsByBidderSince(ctx context.Context, arg CountRetractionsByBidderSinceParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countRetractionsByBidderSince, arg.BidderID, arg.RetractedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createBid = `-- name: CreateBid :one
 INSERT INTO bids (product_id, bidder_id, bid_amount)
 VALUES ($1, $2, $3)
-RETURNING id, product_id, bidder_id, bid_amount, created_at
+RETURNING id, product_id, bidder_id, bid_amount, created_at, retracted_at, retraction_reason, voided_by
 `
 
 type CreateBidParams struct {
-	ProductID uuid.UUID `json:"product_id"`
-	BidderID  uuid.UUID `json:"bidder_id"`
-	BidAmount float64   `json:"bid_amount"`
+	ProductID uuid.UUID    `json:"product_id"`
+	BidderID  uuid.UUID    `json:"bidder_id"`
+	BidAmount money.Amount `json:"bid_amount"`
 }
 
 func (q *Queries) CreateBid(ctx context.Context, arg CreateBidParams) (Bid, error) {
@@ -32,14 +63,66 @@ func (q *Queries) CreateBid(ctx context.Context, arg CreateBidParams) (Bid, erro
 		&i.BidderID,
 		&i.BidAmount,
 		&i.CreatedAt,
+		&i.RetractedAt,
+		&i.RetractionReason,
+		&i.VoidedBy,
+	)
+	return i, err
+}
+
+const getBidByID = `-- name: GetBidByID :one
+SELECT id, product_id, bidder_id, bid_amount, created_at, retracted_at, retraction_reason, voided_by FROM bids
+WHERE id = $1
+`
+
+func (q *Queries) GetBidByID(ctx context.Context, id uuid.UUID) (Bid, error) {
+	row := q.db.QueryRow(ctx, getBidByID, id)
+	var i Bid
+	err := row.Scan(
+		&i.ID,
+		&i.ProductID,
+		&i.BidderID,
+		&i.BidAmount,
+		&i.CreatedAt,
+		&i.RetractedAt,
+		&i.RetractionReason,
+		&i.VoidedBy,
+	)
+	return i, err
+}
+
+const getBidByProductAndBidder = `-- name: GetBidByProductAndBidder :one
+SELECT id, product_id, bidder_id, bid_amount, created_at, retracted_at, retraction_reason, voided_by FROM bids
+WHERE product_id = $1 AND bidder_id = $2 AND retracted_at IS NULL
+ORDER BY created_at DESC
+LIMIT 1
+`
+
+type GetBidByProductAndBidderParams struct {
+	ProductID uuid.UUID `json:"product_id"`
+	BidderID  uuid.UUID `json:"bidder_id"`
+}
+
+func (q *Queries) GetBidByProductAndBidder(ctx context.Context, arg GetBidByProductAndBidderParams) (Bid, error) {
+	row := q.db.QueryRow(ctx, getBidByProductAndBidder, arg.ProductID, arg.BidderID)
+	var i Bid
+	err := row.Scan(
+		&i.ID,
+		&i.ProductID,
+		&i.BidderID,
+		&i.BidAmount,
+		&i.CreatedAt,
+		&i.RetractedAt,
+		&i.RetractionReason,
+		&i.VoidedBy,
 	)
 	return i, err
 }
 
 const getBidsByProductID = `-- name: GetBidsByProductID :many
-SELECT id, product_id, bidder_id, bid_amount, created_at FROM bids
-WHERE product_id = $1
-ORDER BY bid_amount DESC
+SELECT id, product_id, bidder_id, bid_amount, created_at, retracted_at, retraction_reason, voided_by FROM bids
+WHERE product_id = $1 AND retracted_at IS NULL
+ORDER BY bid_amount DESC, created_at ASC
 `
 
 func (q *Queries) GetBidsByProductID(ctx context.Context, productID uuid.UUID) ([]Bid, error) {
@@ -57,6 +140,9 @@ func (q *Queries) GetBidsByProductID(ctx context.Context, productID uuid.UUID) (
 			&i.BidderID,
 			&i.BidAmount,
 			&i.CreatedAt,
+			&i.RetractedAt,
+			&i.RetractionReason,
+			&i.VoidedBy,
 		); err != nil {
 			return nil, err
 		}
@@ -69,8 +155,8 @@ func (q *Queries) GetBidsByProductID(ctx context.Context, productID uuid.UUID) (
 }
 
 const getHighestBidByProductID = `-- name: GetHighestBidByProductID :one
-SELECT id, product_id, bidder_id, bid_amount, created_at FROM bids
-WHERE product_id = $1
+SELECT id, product_id, bidder_id, bid_amount, created_at, retracted_at, retraction_reason, voided_by FROM bids
+WHERE product_id = $1 AND retracted_at IS NULL
 ORDER BY bid_amount DESC
 LIMIT 1
 `
@@ -84,6 +170,107 @@ func (q *Queries) GetHighestBidByProductID(ctx context.Context, productID uuid.U
 		&i.BidderID,
 		&i.BidAmount,
 		&i.CreatedAt,
+		&i.RetractedAt,
+		&i.RetractionReason,
+		&i.VoidedBy,
+	)
+	return i, err
+}
+
+const getRecentBidsByProductID = `-- name: GetRecentBidsByProductID :many
+SELECT id, product_id, bidder_id, bid_amount, created_at, retracted_at, retraction_reason, voided_by FROM bids
+WHERE product_id = $1 AND retracted_at IS NULL
+ORDER BY bid_amount DESC, created_at ASC
+LIMIT $2
+`
+
+type GetRecentBidsByProductIDParams struct {
+	ProductID uuid.UUID `json:"product_id"`
+	Limit     int32     `json:"limit"`
+}
+
+func (q *Queries) GetRecentBidsByProductID(ctx context.Context, arg GetRecentBidsByProductIDParams) ([]Bid, error) {
+	rows, err := q.db.Query(ctx, getRecentBidsByProductID, arg.ProductID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Bid
+	for rows.Next() {
+		var i Bid
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProductID,
+			&i.BidderID,
+			&i.BidAmount,
+			&i.CreatedAt,
+			&i.RetractedAt,
+			&i.RetractionReason,
+			&i.VoidedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const retractBid = `-- name: RetractBid :one
+UPDATE bids
+SET retracted_at = now(), retraction_reason = $2, voided_by = $3
+WHERE id = $1 AND retracted_at IS NULL
+RETURNING id, product_id, bidder_id, bid_amount, created_at, retracted_at, retraction_reason, voided_by
+`
+
+type RetractBidParams struct {
+	ID               uuid.UUID  `json:"id"`
+	RetractionReason string     `json:"retraction_reason"`
+	VoidedBy         *uuid.UUID `json:"voided_by"`
+}
+
+func (q *Queries) RetractBid(ctx context.Context, arg RetractBidParams) (Bid, error) {
+	row := q.db.QueryRow(ctx, retractBid, arg.ID, arg.RetractionReason, arg.VoidedBy)
+	var i Bid
+	err := row.Scan(
+		&i.ID,
+		&i.ProductID,
+		&i.BidderID,
+		&i.BidAmount,
+		&i.CreatedAt,
+		&i.RetractedAt,
+		&i.RetractionReason,
+		&i.VoidedBy,
+	)
+	return i, err
+}
+
+const updateBidAmount = `-- name: UpdateBidAmount :one
+UPDATE bids
+SET bid_amount = $2, created_at = now()
+WHERE id = $1
+RETURNING id, product_id, bidder_id, bid_amount, created_at, retracted_at, retraction_reason, voided_by
+`
+
+type UpdateBidAmountParams struct {
+	ID        uuid.UUID    `json:"id"`
+	BidAmount money.Amount `json:"bid_amount"`
+}
+
+func (q *Queries) UpdateBidAmount(ctx context.Context, arg UpdateBidAmountParams) (Bid, error) {
+	row := q.db.QueryRow(ctx, updateBidAmount, arg.ID, arg.BidAmount)
+	var i Bid
+	err := row.Scan(
+		&i.ID,
+		&i.ProductID,
+		&i.BidderID,
+		&i.BidAmount,
+		&i.CreatedAt,
+		&i.RetractedAt,
+		&i.RetractionReason,
+		&i.VoidedBy,
 	)
 	return i, err
 }
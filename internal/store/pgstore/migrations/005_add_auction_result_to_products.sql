@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+ALTER TABLE products
+    ADD COLUMN winner_id UUID REFERENCES users (id),
+    ADD COLUMN final_price FLOAT;
+---- create above / drop below ----
+ALTER TABLE products
+    DROP COLUMN IF EXISTS final_price,
+    DROP COLUMN IF EXISTS winner_id;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+ALTER TABLE products
+    ADD COLUMN soft_close_window_seconds INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN soft_close_extension_seconds INTEGER NOT NULL DEFAULT 0;
+---- create above / drop below ----
+ALTER TABLE products
+    DROP COLUMN IF EXISTS soft_close_extension_seconds,
+    DROP COLUMN IF EXISTS soft_close_window_seconds;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,16 @@
+-- Write your migrate up statements here
+CREATE TYPE auction_type AS ENUM ('english', 'dutch');
+
+ALTER TABLE products
+    ADD COLUMN auction_type auction_type NOT NULL DEFAULT 'english',
+    ADD COLUMN dutch_price_step FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN dutch_step_interval_seconds INTEGER NOT NULL DEFAULT 0;
+---- create above / drop below ----
+ALTER TABLE products
+    DROP COLUMN IF EXISTS dutch_step_interval_seconds,
+    DROP COLUMN IF EXISTS dutch_price_step,
+    DROP COLUMN IF EXISTS auction_type;
+
+DROP TYPE IF EXISTS auction_type;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
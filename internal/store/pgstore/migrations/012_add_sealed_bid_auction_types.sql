@@ -0,0 +1,4 @@
+-- Write your migrate up statements here
+ALTER TYPE auction_type ADD VALUE IF NOT EXISTS 'sealed_first_price';
+ALTER TYPE auction_type ADD VALUE IF NOT EXISTS 'sealed_second_price';
+-- Values cannot be removed from an enum, so this migration is irreversible.
@@ -0,0 +1,16 @@
+-- Write your migrate up statements here
+ALTER TABLE products
+    ADD COLUMN closed_at TIMESTAMPTZ,
+    ADD COLUMN close_reason TEXT NOT NULL DEFAULT '',
+    ADD COLUMN is_cancelled BOOLEAN NOT NULL DEFAULT false;
+
+-- auctions that ended without a winner may never have been settled, so they
+-- are left open for the server to settle on startup
+UPDATE products SET closed_at = updated_at WHERE is_sold OR winner_id IS NOT NULL;
+---- create above / drop below ----
+ALTER TABLE products
+    DROP COLUMN IF EXISTS is_cancelled,
+    DROP COLUMN IF EXISTS close_reason,
+    DROP COLUMN IF EXISTS closed_at;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
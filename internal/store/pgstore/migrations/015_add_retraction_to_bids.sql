@@ -0,0 +1,18 @@
+-- Write your migrate up statements here
+ALTER TABLE bids
+    ADD COLUMN retracted_at TIMESTAMPTZ,
+    ADD COLUMN retraction_reason TEXT NOT NULL DEFAULT '',
+    ADD COLUMN voided_by UUID REFERENCES users (id);
+
+ALTER TABLE users
+    ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+---- create above / drop below ----
+ALTER TABLE users
+    DROP COLUMN IF EXISTS is_admin;
+
+ALTER TABLE bids
+    DROP COLUMN IF EXISTS voided_by,
+    DROP COLUMN IF EXISTS retraction_reason,
+    DROP COLUMN IF EXISTS retracted_at;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,30 @@
+-- Write your migrate up statements here
+CREATE FUNCTION check_bid_allowed() RETURNS trigger AS $$
+DECLARE
+    product products%ROWTYPE;
+BEGIN
+    SELECT * INTO product FROM products WHERE id = NEW.product_id;
+
+    IF product.is_sold OR product.closed_at IS NOT NULL
+        OR now() < product.auction_start OR now() >= product.auction_end THEN
+        RAISE EXCEPTION 'auction % is not open for bidding', NEW.product_id
+            USING ERRCODE = 'GB001';
+    END IF;
+
+    IF NEW.bidder_id = product.seller_id THEN
+        RAISE EXCEPTION 'sellers cannot bid on their own auction'
+            USING ERRCODE = 'GB002';
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER bids_check_allowed
+    BEFORE INSERT OR UPDATE OF bid_amount ON bids
+    FOR EACH ROW EXECUTE FUNCTION check_bid_allowed();
+---- create above / drop below ----
+DROP TRIGGER IF EXISTS bids_check_allowed ON bids;
+DROP FUNCTION IF EXISTS check_bid_allowed();
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,30 @@
+-- Write your migrate up statements here
+ALTER TABLE products
+    ALTER COLUMN base_price TYPE NUMERIC(19, 4),
+    ALTER COLUMN final_price TYPE NUMERIC(19, 4),
+    ALTER COLUMN bid_increment TYPE NUMERIC(19, 4),
+    ALTER COLUMN reserve_price TYPE NUMERIC(19, 4),
+    ALTER COLUMN buy_now_price TYPE NUMERIC(19, 4),
+    ALTER COLUMN dutch_price_step TYPE NUMERIC(19, 4);
+
+ALTER TABLE bids
+    ALTER COLUMN bid_amount TYPE NUMERIC(19, 4);
+
+ALTER TABLE proxy_bids
+    ALTER COLUMN max_amount TYPE NUMERIC(19, 4);
+---- create above / drop below ----
+ALTER TABLE proxy_bids
+    ALTER COLUMN max_amount TYPE FLOAT;
+
+ALTER TABLE bids
+    ALTER COLUMN bid_amount TYPE FLOAT;
+
+ALTER TABLE products
+    ALTER COLUMN dutch_price_step TYPE FLOAT,
+    ALTER COLUMN buy_now_price TYPE FLOAT,
+    ALTER COLUMN reserve_price TYPE FLOAT,
+    ALTER COLUMN bid_increment TYPE FLOAT,
+    ALTER COLUMN final_price TYPE FLOAT,
+    ALTER COLUMN base_price TYPE FLOAT;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
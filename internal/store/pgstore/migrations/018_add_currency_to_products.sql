@@ -0,0 +1,12 @@
+-- Write your migrate up statements here
+-- Every product listed so far was priced in US dollars.
+ALTER TABLE products
+    ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD';
+
+ALTER TABLE products
+    ALTER COLUMN currency DROP DEFAULT;
+---- create above / drop below ----
+ALTER TABLE products
+    DROP COLUMN IF EXISTS currency;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
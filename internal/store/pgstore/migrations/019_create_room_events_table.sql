@@ -0,0 +1,13 @@
+-- Write your migrate up statements here
+-- Room events too large for a notification reach the other instances
+-- through this table.
+CREATE TABLE IF NOT EXISTS room_events (
+    id BIGSERIAL PRIMARY KEY,
+    auction_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+---- create above / drop below ----
+DROP TABLE IF EXISTS room_events;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,29 @@
+-- Write your migrate up statements here
+CREATE TYPE close_kind AS ENUM (
+    'sold', 'price_accepted', 'bought_outright', 'ended_early',
+    'no_bids', 'reserve_not_met', 'cancelled'
+);
+
+ALTER TABLE products ADD COLUMN close_kind close_kind;
+
+-- close_reason used to record both how an auction closed and the reason of
+-- its seller, which are now kept apart
+UPDATE products SET close_kind = CASE
+    WHEN is_cancelled THEN 'cancelled'
+    WHEN is_sold AND close_reason IN ('', 'auction ended') THEN 'sold'
+    WHEN is_sold AND close_reason = 'price accepted' THEN 'price_accepted'
+    WHEN is_sold AND close_reason = 'bought outright' THEN 'bought_outright'
+    WHEN is_sold THEN 'ended_early'
+    WHEN close_reason = 'reserve price not met' THEN 'reserve_not_met'
+    ELSE 'no_bids'
+END::close_kind
+WHERE closed_at IS NOT NULL;
+
+UPDATE products SET close_reason = ''
+WHERE close_kind NOT IN ('ended_early', 'cancelled');
+---- create above / drop below ----
+ALTER TABLE products DROP COLUMN IF EXISTS close_kind;
+
+DROP TYPE IF EXISTS close_kind;
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
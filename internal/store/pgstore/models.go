@@ -5,29 +5,159 @@
 package pgstore
 
 import (
+	"database/sql/driver"
+	"fmt"
 	"time"
 
+	"github.com/LucasLCabral/go-bid/internal/money"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AuctionType string
+
+const (
+	AuctionTypeEnglish           AuctionType = "english"
+	AuctionTypeDutch             AuctionType = "dutch"
+	AuctionTypeSealedFirstPrice  AuctionType = "sealed_first_price"
+	AuctionTypeSealedSecondPrice AuctionType = "sealed_second_price"
+)
+
+func (e *AuctionType) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = AuctionType(s)
+	case string:
+		*e = AuctionType(s)
+	default:
+		return fmt.Errorf("unsupported scan type for AuctionType: %T", src)
+	}
+	return nil
+}
+
+type NullAuctionType struct {
+	AuctionType AuctionType `json:"auction_type"`
+	Valid       bool        `json:"valid"` // Valid is true if AuctionType is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullAuctionType) Scan(value interface{}) error {
+	if value == nil {
+		ns.AuctionType, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.AuctionType.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullAuctionType) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.AuctionType), nil
+}
+
+type CloseKind string
+
+const (
+	CloseKindSold           CloseKind = "sold"
+	CloseKindPriceAccepted  CloseKind = "price_accepted"
+	CloseKindBoughtOutright CloseKind = "bought_outright"
+	CloseKindEndedEarly     CloseKind = "ended_early"
+	CloseKindNoBids         CloseKind = "no_bids"
+	CloseKindReserveNotMet  CloseKind = "reserve_not_met"
+	CloseKindCancelled      CloseKind = "cancelled"
+)
+
+func (e *CloseKind) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = CloseKind(s)
+	case string:
+		*e = CloseKind(s)
+	default:
+		return fmt.Errorf("unsupported scan type for CloseKind: %T", src)
+	}
+	return nil
+}
+
+type NullCloseKind struct {
+	CloseKind CloseKind `json:"close_kind"`
+	Valid     bool      `json:"valid"` // Valid is true if CloseKind is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullCloseKind) Scan(value interface{}) error {
+	if value == nil {
+		ns.CloseKind, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.CloseKind.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullCloseKind) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.CloseKind), nil
+}
+
 type Bid struct {
-	ID        uuid.UUID `json:"id"`
-	ProductID uuid.UUID `json:"product_id"`
-	BidderID  uuid.UUID `json:"bidder_id"`
-	BidAmount float64   `json:"bid_amount"`
-	CreatedAt time.Time `json:"created_at"`
+	ID               uuid.UUID          `json:"id"`
+	ProductID        uuid.UUID          `json:"product_id"`
+	BidderID         uuid.UUID          `json:"bidder_id"`
+	BidAmount        money.Amount       `json:"bid_amount"`
+	CreatedAt        time.Time          `json:"created_at"`
+	RetractedAt      pgtype.Timestamptz `json:"retracted_at"`
+	RetractionReason string             `json:"retraction_reason"`
+	VoidedBy         *uuid.UUID         `json:"voided_by"`
 }
 
 type Product struct {
-	ID          uuid.UUID `json:"id"`
-	SellerID    uuid.UUID `json:"seller_id"`
-	ProductName string    `json:"product_name"`
-	Description string    `json:"description"`
-	BasePrice   float64   `json:"base_price"`
-	AuctionEnd  time.Time `json:"auction_end"`
-	IsSold      bool      `json:"is_sold"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID                        uuid.UUID          `json:"id"`
+	SellerID                  uuid.UUID          `json:"seller_id"`
+	ProductName               string             `json:"product_name"`
+	Description               string             `json:"description"`
+	BasePrice                 money.Amount       `json:"base_price"`
+	AuctionEnd                time.Time          `json:"auction_end"`
+	IsSold                    bool               `json:"is_sold"`
+	CreatedAt                 time.Time          `json:"created_at"`
+	UpdatedAt                 time.Time          `json:"updated_at"`
+	WinnerID                  *uuid.UUID         `json:"winner_id"`
+	FinalPrice                *money.Amount      `json:"final_price"`
+	SoftCloseWindowSeconds    int32              `json:"soft_close_window_seconds"`
+	SoftCloseExtensionSeconds int32              `json:"soft_close_extension_seconds"`
+	BidIncrement              money.Amount       `json:"bid_increment"`
+	ReservePrice              *money.Amount      `json:"reserve_price"`
+	BuyNowPrice               *money.Amount      `json:"buy_now_price"`
+	AuctionType               AuctionType        `json:"auction_type"`
+	DutchPriceStep            money.Amount       `json:"dutch_price_step"`
+	DutchStepIntervalSeconds  int32              `json:"dutch_step_interval_seconds"`
+	AuctionStart              time.Time          `json:"auction_start"`
+	ClosedAt                  pgtype.Timestamptz `json:"closed_at"`
+	CloseReason               string             `json:"close_reason"`
+	IsCancelled               bool               `json:"is_cancelled"`
+	Currency                  money.Currency     `json:"currency"`
+	CloseKind                 NullCloseKind      `json:"close_kind"`
+}
+
+type ProxyBid struct {
+	ID        uuid.UUID    `json:"id"`
+	ProductID uuid.UUID    `json:"product_id"`
+	BidderID  uuid.UUID    `json:"bidder_id"`
+	MaxAmount money.Amount `json:"max_amount"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+type RoomEvent struct {
+	ID        int64     `json:"id"`
+	AuctionID uuid.UUID `json:"auction_id"`
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Session struct {
@@ -44,4 +174,5 @@ type User struct {
 	Bio          string    `json:"bio"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	IsAdmin      bool      `json:"is_admin"`
 }
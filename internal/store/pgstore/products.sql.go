@@ -9,41 +9,162 @@ import (
 	"context"
 	"time"
 
+	"github.com/LucasLCabral/go-bid/internal/money"
 	"github.com/google/uuid"
 )
 
+const buyNow = `-- name: BuyNow :one
+UPDATE products
+SET is_sold = true, winner_id = $2::uuid, final_price = buy_now_price,
+    closed_at = now(), close_kind = 'bought_outright', updated_at = now()
+WHERE id = $1
+    AND closed_at IS NULL
+    AND buy_now_price IS NOT NULL
+    AND auction_start <= now()
+    AND auction_end > now()
+    AND seller_id <> $2::uuid
+    AND NOT EXISTS (SELECT 1 FROM bids WHERE bids.product_id = products.id AND bids.retracted_at IS NULL)
+RETURNING buy_now_price, currency
+`
+
+type BuyNowParams struct {
+	ID      uuid.UUID `json:"id"`
+	BuyerID uuid.UUID `json:"buyer_id"`
+}
+
+type BuyNowRow struct {
+	BuyNowPrice *money.Amount  `json:"buy_now_price"`
+	Currency    money.Currency `json:"currency"`
+}
+
+func (q *Queries) BuyNow(ctx context.Context, arg BuyNowParams) (BuyNowRow, error) {
+	row := q.db.QueryRow(ctx, buyNow, arg.ID, arg.BuyerID)
+	var i BuyNowRow
+	err := row.Scan(&i.BuyNowPrice, &i.Currency)
+	return i, err
+}
+
+const cancelAuction = `-- name: CancelAuction :execrows
+UPDATE products
+SET is_cancelled = true, close_kind = 'cancelled', close_reason = $2,
+    closed_at = now(), updated_at = now()
+WHERE id = $1 AND closed_at IS NULL
+`
+
+type CancelAuctionParams struct {
+	ID          uuid.UUID `json:"id"`
+	CloseReason string    `json:"close_reason"`
+}
+
+func (q *Queries) CancelAuction(ctx context.Context, arg CancelAuctionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, cancelAuction, arg.ID, arg.CloseReason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const createProduct = `-- name: CreateProduct :one
 INSERT INTO products (
     seller_id, product_name, description,
-    base_price, auction_end
+    base_price, auction_end,
+    soft_close_window_seconds, soft_close_extension_seconds,
+    bid_increment, reserve_price, buy_now_price,
+    auction_type, dutch_price_step, dutch_step_interval_seconds,
+    auction_start, currency
 )
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+RETURNING id, seller_id, product_name, description, base_price, auction_end, is_sold, created_at, updated_at, winner_id, final_price, soft_close_window_seconds, soft_close_extension_seconds, bid_increment, reserve_price, buy_now_price, auction_type, dutch_price_step, dutch_step_interval_seconds, auction_start, closed_at, close_reason, is_cancelled, currency, close_kind
 `
 
 type CreateProductParams struct {
-	SellerID    uuid.UUID `json:"seller_id"`
-	ProductName string    `json:"product_name"`
-	Description string    `json:"description"`
-	BasePrice   float64   `json:"base_price"`
-	AuctionEnd  time.Time `json:"auction_end"`
+	SellerID                  uuid.UUID      `json:"seller_id"`
+	ProductName               string         `json:"product_name"`
+	Description               string         `json:"description"`
+	BasePrice                 money.Amount   `json:"base_price"`
+	AuctionEnd                time.Time      `json:"auction_end"`
+	SoftCloseWindowSeconds    int32          `json:"soft_close_window_seconds"`
+	SoftCloseExtensionSeconds int32          `json:"soft_close_extension_seconds"`
+	BidIncrement              money.Amount   `json:"bid_increment"`
+	ReservePrice              *money.Amount  `json:"reserve_price"`
+	BuyNowPrice               *money.Amount  `json:"buy_now_price"`
+	AuctionType               AuctionType    `json:"auction_type"`
+	DutchPriceStep            money.Amount   `json:"dutch_price_step"`
+	DutchStepIntervalSeconds  int32          `json:"dutch_step_interval_seconds"`
+	AuctionStart              time.Time      `json:"auction_start"`
+	Currency                  money.Currency `json:"currency"`
 }
 
-func (q *Queries) CreateProduct(ctx context.Context, arg CreateProductParams) (uuid.UUID, error) {
+func (q *Queries) CreateProduct(ctx context.Context, arg CreateProductParams) (Product, error) {
 	row := q.db.QueryRow(ctx, createProduct,
 		arg.SellerID,
 		arg.ProductName,
 		arg.Description,
 		arg.BasePrice,
 		arg.AuctionEnd,
+		arg.SoftCloseWindowSeconds,
+		arg.SoftCloseExtensionSeconds,
+		arg.BidIncrement,
+		arg.ReservePrice,
+		arg.BuyNowPrice,
+		arg.AuctionType,
+		arg.DutchPriceStep,
+		arg.DutchStepIntervalSeconds,
+		arg.AuctionStart,
+		arg.Currency,
+	)
+	var i Product
+	err := row.Scan(
+		&i.ID,
+		&i.SellerID,
+		&i.ProductName,
+		&i.Description,
+		&i.BasePrice,
+		&i.AuctionEnd,
+		&i.IsSold,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WinnerID,
+		&i.FinalPrice,
+		&i.SoftCloseWindowSeconds,
+		&i.SoftCloseExtensionSeconds,
+		&i.BidIncrement,
+		&i.ReservePrice,
+		&i.BuyNowPrice,
+		&i.AuctionType,
+		&i.DutchPriceStep,
+		&i.DutchStepIntervalSeconds,
+		&i.AuctionStart,
+		&i.ClosedAt,
+		&i.CloseReason,
+		&i.IsCancelled,
+		&i.Currency,
+		&i.CloseKind,
 	)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+	return i, err
+}
+
+const extendAuction = `-- name: ExtendAuction :one
+UPDATE products
+SET auction_end = $2, updated_at = now()
+WHERE id = $1 AND auction_end < $2
+RETURNING auction_end
+`
+
+type ExtendAuctionParams struct {
+	ID         uuid.UUID `json:"id"`
+	AuctionEnd time.Time `json:"auction_end"`
+}
+
+func (q *Queries) ExtendAuction(ctx context.Context, arg ExtendAuctionParams) (time.Time, error) {
+	row := q.db.QueryRow(ctx, extendAuction, arg.ID, arg.AuctionEnd)
+	var auction_end time.Time
+	err := row.Scan(&auction_end)
+	return auction_end, err
 }
 
 const getProductByID = `-- name: GetProductByID :one
-SELECT id, seller_id, product_name, description, base_price, auction_end, is_sold, created_at, updated_at FROM products
+SELECT id, seller_id, product_name, description, base_price, auction_end, is_sold, created_at, updated_at, winner_id, final_price, soft_close_window_seconds, soft_close_extension_seconds, bid_increment, reserve_price, buy_now_price, auction_type, dutch_price_step, dutch_step_interval_seconds, auction_start, closed_at, close_reason, is_cancelled, currency, close_kind FROM products
 WHERE id = $1
 `
 
@@ -60,6 +181,197 @@ func (q *Queries) GetProductByID(ctx context.Context, id uuid.UUID) (Product, er
 		&i.IsSold,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.WinnerID,
+		&i.FinalPrice,
+		&i.SoftCloseWindowSeconds,
+		&i.SoftCloseExtensionSeconds,
+		&i.BidIncrement,
+		&i.ReservePrice,
+		&i.BuyNowPrice,
+		&i.AuctionType,
+		&i.DutchPriceStep,
+		&i.DutchStepIntervalSeconds,
+		&i.AuctionStart,
+		&i.ClosedAt,
+		&i.CloseReason,
+		&i.IsCancelled,
+		&i.Currency,
+		&i.CloseKind,
+	)
+	return i, err
+}
+
+const getProductByIDForUpdate = `-- name: GetProductByIDForUpdate :one
+SELECT id, seller_id, product_name, description, base_price, auction_end, is_sold, created_at, updated_at, winner_id, final_price, soft_close_window_seconds, soft_close_extension_seconds, bid_increment, reserve_price, buy_now_price, auction_type, dutch_price_step, dutch_step_interval_seconds, auction_start, closed_at, close_reason, is_cancelled, currency, close_kind FROM products
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetProductByIDForUpdate(ctx context.Context, id uuid.UUID) (Product, error) {
+	row := q.db.QueryRow(ctx, getProductByIDForUpdate, id)
+	var i Product
+	err := row.Scan(
+		&i.ID,
+		&i.SellerID,
+		&i.ProductName,
+		&i.Description,
+		&i.BasePrice,
+		&i.AuctionEnd,
+		&i.IsSold,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WinnerID,
+		&i.FinalPrice,
+		&i.SoftCloseWindowSeconds,
+		&i.SoftCloseExtensionSeconds,
+		&i.BidIncrement,
+		&i.ReservePrice,
+		&i.BuyNowPrice,
+		&i.AuctionType,
+		&i.DutchPriceStep,
+		&i.DutchStepIntervalSeconds,
+		&i.AuctionStart,
+		&i.ClosedAt,
+		&i.CloseReason,
+		&i.IsCancelled,
+		&i.Currency,
+		&i.CloseKind,
 	)
 	return i, err
 }
+
+const listActiveAuctions = `-- name: ListActiveAuctions :many
+SELECT id, seller_id, product_name, description, base_price, auction_end, is_sold, created_at, updated_at, winner_id, final_price, soft_close_window_seconds, soft_close_extension_seconds, bid_increment, reserve_price, buy_now_price, auction_type, dutch_price_step, dutch_step_interval_seconds, auction_start, closed_at, close_reason, is_cancelled, currency, close_kind FROM products
+WHERE closed_at IS NULL AND auction_end > now()
+ORDER BY auction_end
+`
+
+func (q *Queries) ListActiveAuctions(ctx context.Context) ([]Product, error) {
+	rows, err := q.db.Query(ctx, listActiveAuctions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Product
+	for rows.Next() {
+		var i Product
+		if err := rows.Scan(
+			&i.ID,
+			&i.SellerID,
+			&i.ProductName,
+			&i.Description,
+			&i.BasePrice,
+			&i.AuctionEnd,
+			&i.IsSold,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.WinnerID,
+			&i.FinalPrice,
+			&i.SoftCloseWindowSeconds,
+			&i.SoftCloseExtensionSeconds,
+			&i.BidIncrement,
+			&i.ReservePrice,
+			&i.BuyNowPrice,
+			&i.AuctionType,
+			&i.DutchPriceStep,
+			&i.DutchStepIntervalSeconds,
+			&i.AuctionStart,
+			&i.ClosedAt,
+			&i.CloseReason,
+			&i.IsCancelled,
+			&i.Currency,
+			&i.CloseKind,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOverdueAuctions = `-- name: ListOverdueAuctions :many
+SELECT id, seller_id, product_name, description, base_price, auction_end, is_sold, created_at, updated_at, winner_id, final_price, soft_close_window_seconds, soft_close_extension_seconds, bid_increment, reserve_price, buy_now_price, auction_type, dutch_price_step, dutch_step_interval_seconds, auction_start, closed_at, close_reason, is_cancelled, currency, close_kind FROM products
+WHERE closed_at IS NULL AND auction_end <= now()
+ORDER BY auction_end
+`
+
+func (q *Queries) ListOverdueAuctions(ctx context.Context) ([]Product, error) {
+	rows, err := q.db.Query(ctx, listOverdueAuctions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Product
+	for rows.Next() {
+		var i Product
+		if err := rows.Scan(
+			&i.ID,
+			&i.SellerID,
+			&i.ProductName,
+			&i.Description,
+			&i.BasePrice,
+			&i.AuctionEnd,
+			&i.IsSold,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.WinnerID,
+			&i.FinalPrice,
+			&i.SoftCloseWindowSeconds,
+			&i.SoftCloseExtensionSeconds,
+			&i.BidIncrement,
+			&i.ReservePrice,
+			&i.BuyNowPrice,
+			&i.AuctionType,
+			&i.DutchPriceStep,
+			&i.DutchStepIntervalSeconds,
+			&i.AuctionStart,
+			&i.ClosedAt,
+			&i.CloseReason,
+			&i.IsCancelled,
+			&i.Currency,
+			&i.CloseKind,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const settleAuction = `-- name: SettleAuction :execrows
+UPDATE products
+SET is_sold = $2, winner_id = $3, final_price = $4,
+    close_kind = $5, close_reason = $6,
+    closed_at = now(), updated_at = now()
+WHERE id = $1 AND closed_at IS NULL
+`
+
+type SettleAuctionParams struct {
+	ID          uuid.UUID     `json:"id"`
+	IsSold      bool          `json:"is_sold"`
+	WinnerID    *uuid.UUID    `json:"winner_id"`
+	FinalPrice  *money.Amount `json:"final_price"`
+	CloseKind   NullCloseKind `json:"close_kind"`
+	CloseReason string        `json:"close_reason"`
+}
+
+func (q *Queries) SettleAuction(ctx context.Context, arg SettleAuctionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, settleAuction,
+		arg.ID,
+		arg.IsSold,
+		arg.WinnerID,
+		arg.FinalPrice,
+		arg.CloseKind,
+		arg.CloseReason,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
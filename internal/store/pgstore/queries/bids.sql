@@ -5,11 +5,47 @@ RETURNING *;
 
 -- name: GetBidsByProductID :many
 SELECT * FROM bids
-WHERE product_id = $1
-ORDER BY bid_amount DESC;
+WHERE product_id = $1 AND retracted_at IS NULL
+ORDER BY bid_amount DESC, created_at ASC;
+
+-- name: GetRecentBidsByProductID :many
+SELECT * FROM bids
+WHERE product_id = $1 AND retracted_at IS NULL
+ORDER BY bid_amount DESC, created_at ASC
+LIMIT $2;
+
+-- name: CountBidsByProductID :one
+SELECT count(*) FROM bids
+WHERE product_id = $1 AND retracted_at IS NULL;
+
+-- name: GetBidByProductAndBidder :one
+SELECT * FROM bids
+WHERE product_id = $1 AND bidder_id = $2 AND retracted_at IS NULL
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: UpdateBidAmount :one
+UPDATE bids
+SET bid_amount = $2, created_at = now()
+WHERE id = $1
+RETURNING *;
 
 -- name: GetHighestBidByProductID :one
 SELECT * FROM bids
-WHERE product_id = $1
+WHERE product_id = $1 AND retracted_at IS NULL
 ORDER BY bid_amount DESC
 LIMIT 1;
+
+-- name: GetBidByID :one
+SELECT * FROM bids
+WHERE id = $1;
+
+-- name: RetractBid :one
+UPDATE bids
+SET retracted_at = now(), retraction_reason = $2, voided_by = $3
+WHERE id = $1 AND retracted_at IS NULL
+RETURNING *;
+
+-- name: CountRetractionsByBidderSince :one
+SELECT count(*) FROM bids
+WHERE bidder_id = $1 AND voided_by IS NULL AND retracted_at >= $2;
@@ -0,0 +1,21 @@
+-- name: Notify :exec
+SELECT pg_notify(@channel::text, @payload::text);
+
+-- name: TryAdvisoryLock :one
+SELECT pg_try_advisory_lock(@key::bigint);
+
+-- name: AdvisoryUnlock :one
+SELECT pg_advisory_unlock(@key::bigint);
+
+-- name: CreateRoomEvent :one
+INSERT INTO room_events (auction_id, payload)
+VALUES ($1, $2)
+RETURNING id;
+
+-- name: GetRoomEventPayload :one
+SELECT payload FROM room_events
+WHERE id = $1;
+
+-- name: DeleteRoomEventsBefore :exec
+DELETE FROM room_events
+WHERE created_at < $1;
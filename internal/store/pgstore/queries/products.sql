@@ -1,11 +1,62 @@
 -- name: CreateProduct :one
 INSERT INTO products (
     seller_id, product_name, description,
-    base_price, auction_end
+    base_price, auction_end,
+    soft_close_window_seconds, soft_close_extension_seconds,
+    bid_increment, reserve_price, buy_now_price,
+    auction_type, dutch_price_step, dutch_step_interval_seconds,
+    auction_start, currency
 )
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id;
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+RETURNING *;
 
 -- name: GetProductByID :one
 SELECT * FROM products
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: GetProductByIDForUpdate :one
+SELECT * FROM products
+WHERE id = $1
+FOR UPDATE;
+
+-- name: BuyNow :one
+UPDATE products
+SET is_sold = true, winner_id = @buyer_id::uuid, final_price = buy_now_price,
+    closed_at = now(), close_kind = 'bought_outright', updated_at = now()
+WHERE id = @id
+    AND closed_at IS NULL
+    AND buy_now_price IS NOT NULL
+    AND auction_start <= now()
+    AND auction_end > now()
+    AND seller_id <> @buyer_id::uuid
+    AND NOT EXISTS (SELECT 1 FROM bids WHERE bids.product_id = products.id AND bids.retracted_at IS NULL)
+RETURNING buy_now_price, currency;
+
+-- name: ListActiveAuctions :many
+SELECT * FROM products
+WHERE closed_at IS NULL AND auction_end > now()
+ORDER BY auction_end;
+
+-- name: ListOverdueAuctions :many
+SELECT * FROM products
+WHERE closed_at IS NULL AND auction_end <= now()
+ORDER BY auction_end;
+
+-- name: SettleAuction :execrows
+UPDATE products
+SET is_sold = $2, winner_id = $3, final_price = $4,
+    close_kind = $5, close_reason = $6,
+    closed_at = now(), updated_at = now()
+WHERE id = $1 AND closed_at IS NULL;
+
+-- name: CancelAuction :execrows
+UPDATE products
+SET is_cancelled = true, close_kind = 'cancelled', close_reason = $2,
+    closed_at = now(), updated_at = now()
+WHERE id = $1 AND closed_at IS NULL;
+
+-- name: ExtendAuction :one
+UPDATE products
+SET auction_end = $2, updated_at = now()
+WHERE id = $1 AND auction_end < $2
+RETURNING auction_end;
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- name: UpsertProxyBid :one
+INSERT INTO proxy_bids (product_id, bidder_id, max_amount)
+VALUES ($1, $2, $3)
+ON CONFLICT (product_id, bidder_id)
+DO UPDATE SET max_amount = EXCLUDED.max_amount, updated_at = now()
+RETURNING *;
+
+-- name: GetProxyBidsByProductID :many
+SELECT * FROM proxy_bids
+WHERE product_id = $1
+ORDER BY max_amount DESC, created_at ASC;
+
+-- name: DeleteProxyBid :exec
+DELETE FROM proxy_bids
+WHERE product_id = $1 AND bidder_id = $2;
@@ -4,12 +4,12 @@ VALUES ($1, $2, $3, $4)
 RETURNING id;
 
 -- name: GetUserByID :one
-SELECT id,user_name, email, password_hash, bio, created_at, updated_at
+SELECT id,user_name, email, password_hash, bio, created_at, updated_at, is_admin
 FROM users
 WHERE id = $1;
 
 -- name: GetUserByEmail :one
-SELECT id,user_name, email, password_hash, bio, created_at, updated_at
+SELECT id,user_name, email, password_hash, bio, created_at, updated_at, is_admin
 FROM users
 WHERE email = $1;
 
@@ -37,7 +37,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (uuid.UU
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id,user_name, email, password_hash, bio, created_at, updated_at
+SELECT id,user_name, email, password_hash, bio, created_at, updated_at, is_admin
 FROM users
 WHERE email = $1
 `
@@ -53,12 +53,13 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Bio,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.IsAdmin,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id,user_name, email, password_hash, bio, created_at, updated_at
+SELECT id,user_name, email, password_hash, bio, created_at, updated_at, is_admin
 FROM users
 WHERE id = $1
 `
@@ -74,6 +75,7 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Bio,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.IsAdmin,
 	)
 	return i, err
 }
@@ -0,0 +1,21 @@
+package bid
+
+import (
+	"context"
+
+	"github.com/LucasLCabral/go-bid/internal/validator"
+)
+
+// RetractBidReq is the body of both bid retractions and admin bid voids.
+type RetractBidReq struct {
+	Reason string `json:"reason"`
+}
+
+func (req RetractBidReq) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	eval.CheckField(validator.NotBlank(req.Reason), "reason", "must be provided")
+	eval.CheckField(validator.MaxChars(req.Reason, 255), "reason", "must be at most 255 characters long")
+
+	return eval
+}
@@ -0,0 +1,20 @@
+package product
+
+import (
+	"context"
+
+	"github.com/LucasLCabral/go-bid/internal/validator"
+)
+
+type CloseAuctionReq struct {
+	Reason string `json:"reason"`
+}
+
+func (req CloseAuctionReq) Valid(ctx context.Context) validator.Evaluator {
+	var eval validator.Evaluator
+
+	eval.CheckField(validator.NotBlank(req.Reason), "reason", "must be provided")
+	eval.CheckField(validator.MaxChars(req.Reason, 255), "reason", "must be at most 255 characters long")
+
+	return eval
+}
@@ -4,19 +4,58 @@ import (
 	"context"
 	"time"
 
+	"github.com/LucasLCabral/go-bid/internal/money"
+	"github.com/LucasLCabral/go-bid/internal/store/pgstore"
 	"github.com/LucasLCabral/go-bid/internal/validator"
 	"github.com/google/uuid"
 )
 
 type CreateProductReq struct {
-	SellerID    uuid.UUID `json:"seller_id"`
-	ProductName string    `json:"product_name"`
-	Description string    `json:"description"`
-	BasePrice   float64   `json:"base_price"`
-	AuctionEnd  time.Time `json:"auction_end"`
+	SellerID    uuid.UUID    `json:"seller_id"`
+	ProductName string       `json:"product_name"`
+	Description string       `json:"description"`
+	BasePrice   money.Amount `json:"base_price"`
+	AuctionEnd  time.Time    `json:"auction_end"`
+
+	// Currency is the ISO 4217 code every price of the product, and every
+	// bid on it, is denominated in.
+	Currency money.Currency `json:"currency"`
+
+	// AuctionStart schedules when bidding opens. A zero value starts the
+	// auction right away.
+	AuctionStart time.Time `json:"auction_start"`
+
+	// A bid placed within SoftCloseWindowSeconds of the end pushes the
+	// auction end to SoftCloseExtensionSeconds after the bid.
+	SoftCloseWindowSeconds    int32 `json:"soft_close_window_seconds"`
+	SoftCloseExtensionSeconds int32 `json:"soft_close_extension_seconds"`
+
+	// BidIncrement is the fixed step between bids. When it is zero the
+	// default tiered increments are used.
+	BidIncrement money.Amount `json:"bid_increment"`
+
+	// ReservePrice is the hidden lowest price the seller accepts. Zero means
+	// the product has no reserve.
+	ReservePrice money.Amount `json:"reserve_price"`
+
+	// BuyNowPrice lets a bidder buy the product outright until the first bid
+	// is placed. Zero disables buying outright.
+	BuyNowPrice money.Amount `json:"buy_now_price"`
+
+	// AuctionType is "english" (the default), "dutch", "sealed_first_price"
+	// or "sealed_second_price". A Dutch auction starts at BasePrice and drops
+	// by DutchPriceStep every DutchStepIntervalSeconds, down to ReservePrice,
+	// until someone accepts the current price. Sealed-bid auctions keep bids
+	// hidden until they close.
+	AuctionType              pgstore.AuctionType `json:"auction_type"`
+	DutchPriceStep           money.Amount        `json:"dutch_price_step"`
+	DutchStepIntervalSeconds int32               `json:"dutch_step_interval_seconds"`
 }
 
-const minAuctionEnd = 2 * time.Hour
+const (
+	minAuctionEnd = 2 * time.Hour
+	maxSoftClose  = 60 * 60
+)
 
 func (req CreateProductReq) Valid(ctx context.Context) validator.Evaluator {
 	var eval validator.Evaluator
@@ -28,7 +67,70 @@ func (req CreateProductReq) Valid(ctx context.Context) validator.Evaluator {
 			validator.MaxChars(req.Description, 255),
 		"description", "must be between 10 and 255 characters long",
 	)
+	eval.CheckField(req.Currency.Valid(), "currency", "must be a supported ISO 4217 currency code")
 	eval.CheckField(req.BasePrice > 0, "base_price", "must be greater than 0")
+	for key, amount := range map[string]money.Amount{
+		"base_price":       req.BasePrice,
+		"bid_increment":    req.BidIncrement,
+		"reserve_price":    req.ReservePrice,
+		"buy_now_price":    req.BuyNowPrice,
+		"dutch_price_step": req.DutchPriceStep,
+	} {
+		eval.CheckField(!req.Currency.Valid() || req.Currency.Allows(amount), key, "must not have more decimal places than currency allows")
+	}
 	eval.CheckField(time.Until(req.AuctionEnd) >= minAuctionEnd, "auction_end", "must be at least 2 hours from now")
+	if !req.AuctionStart.IsZero() {
+		eval.CheckField(time.Until(req.AuctionStart) > 0, "auction_start", "must be in the future")
+		eval.CheckField(req.AuctionEnd.Sub(req.AuctionStart) >= minAuctionEnd, "auction_end", "must be at least 2 hours after auction_start")
+	}
+	eval.CheckField(
+		req.SoftCloseWindowSeconds >= 0 &&
+			req.SoftCloseWindowSeconds <= maxSoftClose,
+		"soft_close_window_seconds", "must be between 0 and 3600 seconds",
+	)
+	eval.CheckField(
+		req.SoftCloseExtensionSeconds >= 0 &&
+			req.SoftCloseExtensionSeconds <= maxSoftClose,
+		"soft_close_extension_seconds", "must be between 0 and 3600 seconds",
+	)
+	eval.CheckField(
+		(req.SoftCloseWindowSeconds == 0) == (req.SoftCloseExtensionSeconds == 0),
+		"soft_close_extension_seconds", "must be provided together with soft_close_window_seconds",
+	)
+	eval.CheckField(req.BidIncrement >= 0, "bid_increment", "must not be negative")
+	eval.CheckField(req.ReservePrice >= 0, "reserve_price", "must not be negative")
+	if req.AuctionType != pgstore.AuctionTypeDutch {
+		eval.CheckField(
+			req.ReservePrice == 0 || req.ReservePrice >= req.BasePrice,
+			"reserve_price", "must not be lower than base_price",
+		)
+	}
+	eval.CheckField(
+		req.BuyNowPrice == 0 || (req.BuyNowPrice > req.BasePrice && req.BuyNowPrice >= req.ReservePrice),
+		"buy_now_price", "must be greater than base_price and not lower than reserve_price",
+	)
+	eval.CheckField(
+		req.AuctionType == "" ||
+			req.AuctionType == pgstore.AuctionTypeEnglish ||
+			req.AuctionType == pgstore.AuctionTypeDutch ||
+			req.AuctionType == pgstore.AuctionTypeSealedFirstPrice ||
+			req.AuctionType == pgstore.AuctionTypeSealedSecondPrice,
+		"auction_type", "must be english, dutch, sealed_first_price or sealed_second_price",
+	)
+	if req.AuctionType != "" && req.AuctionType != pgstore.AuctionTypeEnglish {
+		eval.CheckField(req.BuyNowPrice == 0, "buy_now_price", "is only available for english auctions")
+		eval.CheckField(req.SoftCloseWindowSeconds == 0, "soft_close_window_seconds", "is only available for english auctions")
+	}
+	if req.AuctionType == pgstore.AuctionTypeDutch {
+		eval.CheckField(req.DutchPriceStep > 0, "dutch_price_step", "must be greater than 0")
+		eval.CheckField(req.DutchStepIntervalSeconds > 0, "dutch_step_interval_seconds", "must be greater than 0")
+		// the price of a Dutch auction drops from base_price down to
+		// reserve_price, or down to a single dutch_price_step
+		eval.CheckField(req.ReservePrice < req.BasePrice, "reserve_price", "must be lower than base_price")
+		eval.CheckField(
+			req.ReservePrice > 0 || req.DutchPriceStep < req.BasePrice,
+			"dutch_price_step", "must be lower than base_price when there is no reserve_price",
+		)
+	}
 	return eval
 }